@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/chenpt0809/pt-exporter/client"
+	"github.com/chenpt0809/pt-exporter/global"
+	"github.com/chenpt0809/pt-exporter/initialize"
+	"go.uber.org/zap"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// checkResult 单个下载器的检查结果
+type checkResult struct {
+	config   initialize.DownloaderConfig
+	latency  time.Duration
+	version  string
+	torrents int
+	err      error
+}
+
+// runCheck 实现 check 子命令 校验配置并逐个连接下载器 返回进程退出码
+func runCheck(args []string) int {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	configPath := flags.String("config", "", "配置文件路径 默认读取当前目录下的 config.yml")
+	verbose := flags.Bool("verbose", false, "输出客户端日志")
+	_ = flags.Parse(args)
+	// 客户端日志会打乱表格 默认关闭
+	if *verbose {
+		global.Logger = initialize.Zap(zap.NewAtomicLevelAt(zap.DebugLevel))
+	} else {
+		global.Logger = zap.NewNop()
+	}
+	viper, err := initialize.Viper(*configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	configs := initialize.DownloaderConfigs(viper)
+	if len(configs) == 0 {
+		fmt.Fprintln(os.Stderr, "配置文件中没有下载器 "+viper.ConfigFileUsed())
+		return 1
+	}
+	failed := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tTYPE\tHOST\tRESULT\tLATENCY\tVERSION\tTORRENTS\tERROR")
+	for _, c := range configs {
+		r := checkDownloader(c)
+		result, torrents, message := "OK", strconv.Itoa(r.torrents), ""
+		if r.err != nil {
+			failed++
+			result, torrents, message = "FAIL", "-", r.err.Error()
+		}
+		version := r.version
+		if version == "" {
+			version = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			c.Name, c.Type, c.Host, result, r.latency.Round(time.Millisecond), version, torrents, message)
+	}
+	_ = w.Flush()
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d/%d 个下载器检查失败\n", failed, len(configs))
+		return 1
+	}
+	return 0
+}
+
+// checkDownloader 校验配置后登录下载器并获取一次数据
+func checkDownloader(c initialize.DownloaderConfig) (r checkResult) {
+	r.config = c
+	if err := c.Validate(); err != nil {
+		r.err = err
+		return r
+	}
+	start := time.Now()
+	defer func() { r.latency = time.Since(start) }()
+	downloader, err := initialize.NewDownloader(c)
+	if err != nil {
+		r.err = err
+		return r
+	}
+	if refresher, ok := downloader.(client.Refresher); ok {
+		if err := refresher.Refresh(); err != nil {
+			r.err = err
+			return r
+		}
+	}
+	if _, err := downloader.Status(); err != nil {
+		r.err = err
+		return r
+	}
+	torrents, err := downloader.Torrents()
+	if err != nil {
+		r.err = err
+		return r
+	}
+	r.torrents = len(torrents)
+	version, err := downloader.Version()
+	if err != nil && !errors.Is(err, client.ErrNotSupported) {
+		r.err = err
+		return r
+	}
+	r.version = version.Version
+	return r
+}
@@ -0,0 +1,303 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/chenpt0809/pt-exporter/global"
+	"go.uber.org/zap"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Aria2Client struct {
+	instrument
+	client   *http.Client
+	Address  string
+	Secret   string
+	baseURL  string
+	id       int
+	mutex    sync.Mutex
+	stat     Aria2GlobalStat
+	torrents []Aria2Torrent
+}
+
+type Aria2Options struct {
+	Url            string
+	Secret         string
+	RequestTimeOut int
+}
+
+// Aria2GlobalStat aria2.getGlobalStat 返回数据 aria2 所有数值均以字符串返回
+type Aria2GlobalStat struct {
+	DownloadSpeed   int64 `json:"downloadSpeed,string"`
+	UploadSpeed     int64 `json:"uploadSpeed,string"`
+	NumActive       int   `json:"numActive,string"`
+	NumWaiting      int   `json:"numWaiting,string"`
+	NumStopped      int   `json:"numStopped,string"`
+	NumStoppedTotal int   `json:"numStoppedTotal,string"`
+}
+
+// Aria2Torrent aria2.tellActive 等接口返回的任务信息
+type Aria2Torrent struct {
+	Gid             string `json:"gid"`
+	Status          string `json:"status"`
+	TotalLength     int64  `json:"totalLength,string"`
+	CompletedLength int64  `json:"completedLength,string"`
+	UploadLength    int64  `json:"uploadLength,string"`
+	DownloadSpeed   int64  `json:"downloadSpeed,string"`
+	UploadSpeed     int64  `json:"uploadSpeed,string"`
+	InfoHash        string `json:"infoHash"`
+	ErrorCode       string `json:"errorCode"`
+	Dir             string `json:"dir"`
+	Bittorrent      *struct {
+		AnnounceList [][]string `json:"announceList"`
+		Info         struct {
+			Name string `json:"name"`
+		} `json:"info"`
+	} `json:"bittorrent"`
+}
+
+type aria2Request struct {
+	JsonRpc string        `json:"jsonrpc"`
+	ID      string        `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+type aria2Response struct {
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// aria2TorrentKeys 需要返回的任务字段
+var aria2TorrentKeys = []string{
+	"gid", "status", "totalLength", "completedLength", "uploadLength", "downloadSpeed",
+	"uploadSpeed", "infoHash", "errorCode", "dir", "bittorrent",
+}
+
+func NewAria2Client(Options Aria2Options) *Aria2Client {
+	global.Logger.Debug("创建：Aria2Client")
+	baseURL := Options.Url
+	// 未填写路径时使用默认的 /jsonrpc
+	if u, err := url.Parse(Options.Url); err == nil && strings.Trim(u.Path, "/") == "" {
+		baseURL = strings.TrimSuffix(Options.Url, "/") + "/jsonrpc"
+	}
+	return &Aria2Client{
+		client:  &http.Client{Timeout: time.Second * time.Duration(Options.RequestTimeOut)},
+		Address: Options.Url,
+		Secret:  Options.Secret,
+		baseURL: baseURL,
+	}
+}
+
+// call 调用 aria2 JSON-RPC 方法 自动附加 token
+func (c *Aria2Client) call(method string, result interface{}, params ...interface{}) (err error) {
+	start := time.Now()
+	defer func() { c.observe(method, start, err) }()
+	c.mutex.Lock()
+	c.id++
+	req := aria2Request{JsonRpc: "2.0", ID: strconv.Itoa(c.id), Method: method}
+	c.mutex.Unlock()
+	if c.Secret != "" {
+		req.Params = append(req.Params, "token:"+c.Secret)
+	}
+	req.Params = append(req.Params, params...)
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Post(c.baseURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		global.Logger.Error("请求发送失败"+c.Address, zap.String("method", method), zap.Error(err))
+		return err
+	}
+	defer resp.Body.Close()
+	var rpcResp aria2Response
+	if err := json.NewDecoder(resp.Body).Decode(&rpcResp); err != nil {
+		global.Logger.Error("解析返回数据失败"+c.Address, zap.String("method", method), zap.Error(err))
+		return err
+	}
+	if rpcResp.Error != nil {
+		// secret 错误
+		if rpcResp.Error.Message == "Unauthorized" {
+			return fmt.Errorf("%s 调用失败: %s: %w", method, rpcResp.Error.Message, ErrAuth)
+		}
+		return errors.New(method + " 调用失败: " + rpcResp.Error.Message)
+	}
+	if resp.StatusCode != 200 {
+		return &StatusError{Message: "请求失败" + c.Address, Code: resp.StatusCode}
+	}
+	return json.Unmarshal(rpcResp.Result, result)
+}
+
+// GetGlobalStat 获取全局状态
+func (c *Aria2Client) GetGlobalStat() (Aria2GlobalStat, error) {
+	global.Logger.Debug("获取下载器状态" + c.Address)
+	var stat Aria2GlobalStat
+	if err := c.call("aria2.getGlobalStat", &stat); err != nil {
+		global.Logger.Error("获取下载器状态失败"+c.Address, zap.Error(err))
+		return stat, err
+	}
+	global.Logger.Debug("获取状态成功" + c.Address)
+	return stat, nil
+}
+
+// GetTorrents 获取活动、等待及已停止的 BT 任务 非 BT 任务、已移除及只有元数据的任务会被忽略
+func (c *Aria2Client) GetTorrents(stat Aria2GlobalStat) ([]Aria2Torrent, error) {
+	global.Logger.Debug("获取种子信息" + c.Address)
+	var active, waiting, stopped []Aria2Torrent
+	if err := c.call("aria2.tellActive", &active, aria2TorrentKeys); err != nil {
+		global.Logger.Error("获取种子信息失败"+c.Address, zap.Error(err))
+		return nil, err
+	}
+	if stat.NumWaiting > 0 {
+		if err := c.call("aria2.tellWaiting", &waiting, 0, stat.NumWaiting, aria2TorrentKeys); err != nil {
+			global.Logger.Error("获取种子信息失败"+c.Address, zap.Error(err))
+			return nil, err
+		}
+	}
+	if stat.NumStopped > 0 {
+		if err := c.call("aria2.tellStopped", &stopped, 0, stat.NumStopped, aria2TorrentKeys); err != nil {
+			global.Logger.Error("获取种子信息失败"+c.Address, zap.Error(err))
+			return nil, err
+		}
+	}
+	// 同一 infoHash 可能出现多次 例如磁力链接的元数据任务与后续下载任务 按活动、等待、已停止的顺序保留第一个
+	torrents := make([]Aria2Torrent, 0, len(active)+len(waiting)+len(stopped))
+	seen := make(map[string]struct{}, cap(torrents))
+	for _, list := range [][]Aria2Torrent{active, waiting, stopped} {
+		for _, t := range list {
+			if t.InfoHash == "" || t.Bittorrent == nil || t.Status == "removed" {
+				continue
+			}
+			// 只有元数据的任务 种子信息由后续任务提供
+			if t.Bittorrent.Info.Name == "" {
+				continue
+			}
+			if _, ok := seen[t.InfoHash]; ok {
+				continue
+			}
+			seen[t.InfoHash] = struct{}{}
+			torrents = append(torrents, t)
+		}
+	}
+	global.Logger.Debug(fmt.Sprintf("获取种子信息完成 %s 共 %d 个", c.Address, len(torrents)))
+	return torrents, nil
+}
+
+// Name 种子名称 磁力链接未获取到元数据时使用 infoHash
+func (t Aria2Torrent) Name() string {
+	if t.Bittorrent != nil && t.Bittorrent.Info.Name != "" {
+		return t.Bittorrent.Info.Name
+	}
+	return t.InfoHash
+}
+
+// Tracker 第一个 tier 的第一个 tracker
+func (t Aria2Torrent) Tracker() string {
+	if t.Bittorrent == nil {
+		return ""
+	}
+	for _, tier := range t.Bittorrent.AnnounceList {
+		if len(tier) > 0 {
+			return tier[0]
+		}
+	}
+	return ""
+}
+
+// Refresh 获取全局状态与全部 BT 任务
+func (c *Aria2Client) Refresh() error {
+	stat, err := c.GetGlobalStat()
+	if err != nil {
+		return err
+	}
+	torrents, err := c.GetTorrents(stat)
+	if err != nil {
+		return err
+	}
+	c.stat = stat
+	c.torrents = torrents
+	return nil
+}
+
+// Status aria2 只提供当前速度 不提供累计流量
+func (c *Aria2Client) Status() (Status, error) {
+	return Status{
+		DownloadSpeed: c.stat.DownloadSpeed,
+		UploadSpeed:   c.stat.UploadSpeed,
+		NoTotal:       true,
+	}, nil
+}
+
+// Torrents 全部 BT 任务
+func (c *Aria2Client) Torrents() ([]Torrent, error) {
+	torrents := make([]Torrent, 0, len(c.torrents))
+	for _, t := range c.torrents {
+		torrent := Torrent{
+			Hash:       t.InfoHash,
+			Name:       t.Name(),
+			Tracker:    t.Tracker(),
+			SavePath:   t.Dir,
+			State:      aria2State(t),
+			Size:       t.TotalLength,
+			Downloaded: t.CompletedLength,
+			Uploaded:   t.UploadLength,
+
+			DownloadSpeed: t.DownloadSpeed,
+			UploadSpeed:   t.UploadSpeed,
+			NoPeers:       true,
+			NoTimes:       true,
+		}
+		if t.TotalLength > 0 {
+			torrent.Progress = float64(t.CompletedLength) / float64(t.TotalLength)
+			torrent.Ratio = float64(t.UploadLength) / float64(t.TotalLength)
+		}
+		torrents = append(torrents, torrent)
+	}
+	return torrents, nil
+}
+
+// FreeSpace aria2 不提供磁盘空间
+func (c *Aria2Client) FreeSpace() (int64, error) {
+	return 0, ErrNotSupported
+}
+
+// Version 获取 aria2 版本
+func (c *Aria2Client) Version() (VersionInfo, error) {
+	var version struct {
+		Version string `json:"version"`
+	}
+	if err := c.call("aria2.getVersion", &version); err != nil {
+		return VersionInfo{}, err
+	}
+	return VersionInfo{Version: version.Version}, nil
+}
+
+// aria2State aria2 任务状态转换为统一状态 做种中的任务状态仍为 active 根据完成度区分
+func aria2State(t Aria2Torrent) string {
+	switch t.Status {
+	case "active":
+		if t.TotalLength > 0 && t.CompletedLength >= t.TotalLength {
+			return StateUploading
+		}
+		return StateDownloading
+	case "waiting":
+		return StateQueued
+	case "paused", "complete":
+		return StatePaused
+	case "error":
+		return StateError
+	default:
+		return t.Status
+	}
+}
@@ -0,0 +1,374 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/chenpt0809/pt-exporter/global"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/cookiejar"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type DelugeClient struct {
+	instrument
+	client   *http.Client
+	Address  string
+	Password string
+	baseURL  string
+	IsLogin  bool
+	id       int
+	mutex    sync.Mutex
+	ui       DelugeUI
+	session  DelugeSessionStatus
+}
+
+type DelugeOptions struct {
+	Url            string
+	Password       string
+	RequestTimeOut int
+}
+
+// DelugeTorrent web.update_ui 返回的种子信息
+type DelugeTorrent struct {
+	Name             string  `json:"name"`
+	State            string  `json:"state"`
+	TotalSize        int64   `json:"total_size"`
+	TotalWanted      int64   `json:"total_wanted"`
+	TotalDone        int64   `json:"total_done"`
+	AllTimeDownload  int64   `json:"all_time_download"`
+	TotalUploaded    int64   `json:"total_uploaded"`
+	Tracker          string  `json:"tracker"`
+	TrackerHost      string  `json:"tracker_host"`
+	Label            string  `json:"label"`
+	SavePath         string  `json:"save_path"`
+	Progress         float64 `json:"progress"`
+	DownloadRate     int64   `json:"download_payload_rate"`
+	UploadRate       int64   `json:"upload_payload_rate"`
+	Ratio            float64 `json:"ratio"`
+	NumSeeds         int64   `json:"num_seeds"`
+	TotalSeeds       int64   `json:"total_seeds"`
+	NumPeers         int64   `json:"num_peers"`
+	TotalPeers       int64   `json:"total_peers"`
+	TimeAdded        float64 `json:"time_added"`
+	CompletedTime    int64   `json:"completed_time"`
+	LastSeenComplete int64   `json:"last_seen_complete"`
+	ActiveTime       int64   `json:"active_time"`
+	SeedingTime      int64   `json:"seeding_time"`
+}
+
+// DelugeUI web.update_ui 返回数据
+type DelugeUI struct {
+	Connected bool                     `json:"connected"`
+	Torrents  map[string]DelugeTorrent `json:"torrents"`
+	Stats     struct {
+		DownloadRate float64 `json:"download_rate"`
+		UploadRate   float64 `json:"upload_rate"`
+		FreeSpace    int64   `json:"free_space"`
+	} `json:"stats"`
+}
+
+// DelugeSessionStatus core.get_session_status 返回数据
+type DelugeSessionStatus struct {
+	TotalDownload       int64   `json:"total_download"`
+	TotalUpload         int64   `json:"total_upload"`
+	PayloadDownloadRate float64 `json:"payload_download_rate"`
+	PayloadUploadRate   float64 `json:"payload_upload_rate"`
+}
+
+type delugeRequest struct {
+	Method string        `json:"method"`
+	Params []interface{} `json:"params"`
+	ID     int           `json:"id"`
+}
+
+type delugeResponse struct {
+	ID     int             `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Message string `json:"message"`
+		Code    int    `json:"code"`
+	} `json:"error"`
+}
+
+// errDelugeDisconnected web 未连接到 deluged
+var errDelugeDisconnected = errors.New("deluge web 未连接到守护进程")
+
+// delugeTorrentKeys 需要向 web.update_ui 请求的种子字段
+var delugeTorrentKeys = []string{
+	"name", "state", "total_size", "total_wanted", "total_done", "all_time_download",
+	"total_uploaded", "tracker", "tracker_host", "label", "save_path", "progress",
+	"download_payload_rate", "upload_payload_rate", "ratio", "num_seeds", "total_seeds", "num_peers", "total_peers",
+	"time_added", "completed_time", "last_seen_complete", "active_time", "seeding_time",
+}
+
+func NewDelugeClient(Options DelugeOptions) *DelugeClient {
+	global.Logger.Debug("创建：DelugeClient")
+	jar, _ := cookiejar.New(nil)
+	c := &DelugeClient{
+		client: &http.Client{
+			Jar:     jar,
+			Timeout: time.Second * time.Duration(Options.RequestTimeOut),
+		},
+		Address:  Options.Url,
+		Password: Options.Password,
+		baseURL:  fmt.Sprintf("%s/json", strings.TrimSuffix(Options.Url, "/")),
+	}
+	// 尝试登录
+	global.Logger.Debug(fmt.Sprintf("初次登录： %s", Options.Url))
+	if err := c.Login(); err != nil {
+		global.Logger.Error("初次登录失败", zap.Error(err))
+	}
+	return c
+}
+
+// call 发送 JSON-RPC 请求并将结果解析到 result
+func (c *DelugeClient) call(method string, result interface{}, params ...interface{}) (err error) {
+	start := time.Now()
+	defer func() { c.observe(method, start, err) }()
+	c.mutex.Lock()
+	c.id++
+	req := delugeRequest{Method: method, Params: params, ID: c.id}
+	c.mutex.Unlock()
+	if req.Params == nil {
+		req.Params = []interface{}{}
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequest("POST", c.baseURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "application/json")
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		global.Logger.Error("请求发送失败"+c.Address, zap.String("method", method), zap.Error(err))
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		global.Logger.Error("请求失败" + c.Address + "状态码非200 状态码为:" + strconv.Itoa(resp.StatusCode))
+		return &StatusError{Message: "请求失败" + c.Address, Code: resp.StatusCode}
+	}
+	var rpcResp delugeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&rpcResp); err != nil {
+		global.Logger.Error("解析返回数据失败"+c.Address, zap.String("method", method), zap.Error(err))
+		return err
+	}
+	if rpcResp.Error != nil {
+		// 未登录或会话过期
+		if rpcResp.Error.Code == 1 {
+			c.IsLogin = false
+			return fmt.Errorf("%s 调用失败: %s: %w", method, rpcResp.Error.Message, ErrAuth)
+		}
+		return errors.New(method + " 调用失败: " + rpcResp.Error.Message)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(rpcResp.Result, result)
+}
+
+// Login 登录并确保 web 已连接到 deluged
+func (c *DelugeClient) Login() error {
+	global.Logger.Debug("开始登录")
+	var ok bool
+	err := c.call("auth.login", &ok, c.Password)
+	if err == nil && !ok {
+		err = fmt.Errorf("登录失败 密码错误%s: %w", c.Address, ErrAuth)
+	}
+	c.observeLogin(err)
+	if err != nil {
+		global.Logger.Error("登录失败：", zap.Error(err))
+		c.IsLogin = false
+		return err
+	}
+	// 连接守护进程成功后才视为登录完成 失败时下次轮询重新登录
+	if err := c.connect(); err != nil {
+		global.Logger.Error("连接守护进程失败"+c.Address, zap.Error(err))
+		c.IsLogin = false
+		return err
+	}
+	c.IsLogin = true
+	return nil
+}
+
+// connect web 未连接到 deluged 时连接第一个守护进程
+func (c *DelugeClient) connect() error {
+	var connected bool
+	if err := c.call("web.connected", &connected); err != nil {
+		return err
+	}
+	if connected {
+		return nil
+	}
+	var hosts [][]interface{}
+	if err := c.call("web.get_hosts", &hosts); err != nil {
+		return err
+	}
+	if len(hosts) == 0 || len(hosts[0]) == 0 {
+		return errors.New("deluge web 未配置守护进程" + c.Address)
+	}
+	hostID, _ := hosts[0][0].(string)
+	global.Logger.Debug("连接守护进程 " + hostID + " " + c.Address)
+	return c.call("web.connect", nil, hostID)
+}
+
+// GetUI 获取种子及全局状态
+func (c *DelugeClient) GetUI() (DelugeUI, error) {
+	global.Logger.Debug("获取种子信息" + c.Address)
+	var ui DelugeUI
+	if err := c.call("web.update_ui", &ui, delugeTorrentKeys, map[string]interface{}{}); err != nil {
+		global.Logger.Error("获取种子信息失败"+c.Address, zap.Error(err))
+		return ui, err
+	}
+	if !ui.Connected {
+		return ui, fmt.Errorf("%w%s", errDelugeDisconnected, c.Address)
+	}
+	global.Logger.Debug("获取种子信息完成" + c.Address)
+	return ui, nil
+}
+
+// GetSessionStatus 获取会话统计
+func (c *DelugeClient) GetSessionStatus() (DelugeSessionStatus, error) {
+	global.Logger.Debug("获取下载器状态" + c.Address)
+	var status DelugeSessionStatus
+	keys := []string{"total_download", "total_upload", "payload_download_rate", "payload_upload_rate"}
+	if err := c.call("core.get_session_status", &status, keys); err != nil {
+		global.Logger.Error("获取下载器状态失败"+c.Address, zap.Error(err))
+		return status, err
+	}
+	global.Logger.Debug("获取状态成功" + c.Address)
+	return status, nil
+}
+
+// Refresh 登录并获取种子及会话统计
+func (c *DelugeClient) Refresh() error {
+	// 判断是否登录 未登录进行登录
+	if !c.IsLogin {
+		if err := c.Login(); err != nil {
+			return err
+		}
+	}
+	ui, err := c.GetUI()
+	// deluged 重启后 web 不会自动重新连接
+	if errors.Is(err, errDelugeDisconnected) {
+		if err := c.connect(); err != nil {
+			return err
+		}
+		ui, err = c.GetUI()
+	}
+	if err != nil {
+		return err
+	}
+	session, err := c.GetSessionStatus()
+	if err != nil {
+		return err
+	}
+	c.ui = ui
+	c.session = session
+	return nil
+}
+
+// Status 全局速度与本次会话流量
+func (c *DelugeClient) Status() (Status, error) {
+	return Status{
+		DownloadSpeed:   int64(c.session.PayloadDownloadRate),
+		UploadSpeed:     int64(c.session.PayloadUploadRate),
+		DownloadedTotal: c.session.TotalDownload,
+		UploadedTotal:   c.session.TotalUpload,
+	}, nil
+}
+
+// Torrents 全部种子
+func (c *DelugeClient) Torrents() ([]Torrent, error) {
+	torrents := make([]Torrent, 0, len(c.ui.Torrents))
+	for hash, t := range c.ui.Torrents {
+		tracker := t.Tracker
+		if tracker == "" {
+			tracker = t.TrackerHost
+		}
+		torrent := Torrent{
+			Hash:       hash,
+			Name:       t.Name,
+			Tracker:    tracker,
+			Category:   t.Label,
+			SavePath:   t.SavePath,
+			State:      delugeState(t.State),
+			Size:       t.TotalWanted,
+			Downloaded: t.AllTimeDownload,
+			Uploaded:   t.TotalUploaded,
+
+			DownloadSpeed: t.DownloadRate,
+			UploadSpeed:   t.UploadRate,
+			Progress:      t.Progress / 100,
+			Seeds:         t.NumSeeds,
+			SeedsTotal:    t.TotalSeeds,
+			Leechers:      t.NumPeers,
+			LeechersTotal: t.TotalPeers,
+
+			AddedOn:      int64(t.TimeAdded),
+			CompletedOn:  t.CompletedTime,
+			SeenComplete: t.LastSeenComplete,
+			ActiveTime:   t.ActiveTime,
+			SeedingTime:  t.SeedingTime,
+		}
+		// 未上传时 Deluge 返回 -1
+		if t.Ratio > 0 {
+			torrent.Ratio = t.Ratio
+		}
+		torrents = append(torrents, torrent)
+	}
+	return torrents, nil
+}
+
+// FreeSpace 默认下载目录剩余空间
+func (c *DelugeClient) FreeSpace() (int64, error) {
+	return c.ui.Stats.FreeSpace, nil
+}
+
+// Version 获取 deluged 版本及 libtorrent 版本
+func (c *DelugeClient) Version() (VersionInfo, error) {
+	var version string
+	if err := c.call("daemon.info", &version); err != nil {
+		return VersionInfo{}, err
+	}
+	info := VersionInfo{Version: version}
+	var libtorrent string
+	if err := c.call("core.get_libtorrent_version", &libtorrent); err == nil {
+		info.Libtorrent = libtorrent
+	}
+	return info, nil
+}
+
+// delugeState Deluge 种子状态转换为统一状态
+func delugeState(state string) string {
+	switch state {
+	case "Allocating":
+		return StateAllocating
+	case "Downloading":
+		return StateDownloading
+	case "Seeding":
+		return StateUploading
+	case "Checking":
+		return StateChecking
+	case "Error":
+		return StateError
+	case "Queued":
+		return StateQueued
+	case "Paused":
+		return StatePaused
+	case "Moving":
+		return StateMoving
+	default:
+		return state
+	}
+}
@@ -0,0 +1,93 @@
+package client
+
+import "errors"
+
+// ErrNotSupported 下载器不提供该数据
+var ErrNotSupported = errors.New("下载器不支持该数据")
+
+// Downloader 下载器通用接口 新增下载器只需实现该接口即可获得全部指标
+type Downloader interface {
+	// Status 全局速度与累计流量
+	Status() (Status, error)
+	// Torrents 全部种子
+	Torrents() ([]Torrent, error)
+	// FreeSpace 默认下载目录剩余空间 单位字节 不支持时返回 ErrNotSupported
+	FreeSpace() (int64, error)
+	// Version 下载器版本 需要登录的下载器在 Refresh 之后调用
+	Version() (VersionInfo, error)
+}
+
+// VersionInfo 下载器版本信息 未知的字段为空
+type VersionInfo struct {
+	Version    string // 下载器版本
+	APIVersion string // 接口版本 如 qBittorrent WebAPI、Transmission RPC
+	Libtorrent string // libtorrent 版本
+}
+
+// Refresher 一次请求即可获取全部数据的下载器实现该接口
+// 每轮采集前调用 Refresh 之后 Status、Torrents、FreeSpace 读取本次刷新的数据
+type Refresher interface {
+	Refresh() error
+}
+
+// PathFreeSpacer 可以查询任意目录剩余空间的下载器实现该接口
+type PathFreeSpacer interface {
+	// PathFreeSpace 目录所在磁盘剩余空间 单位字节
+	PathFreeSpace(path string) (int64, error)
+}
+
+// Status 下载器全局状态
+type Status struct {
+	DownloadSpeed   int64 // 当前下载速度 单位字节
+	UploadSpeed     int64 // 当前上传速度 单位字节
+	DownloadedTotal int64 // 累计下载 单位字节
+	UploadedTotal   int64 // 累计上传 单位字节
+	NoTotal         bool  // 下载器不提供累计流量
+}
+
+// 统一后的种子状态 与 collector 中的状态码一一对应
+const (
+	StateUnknown     = "unknown"
+	StateAllocating  = "allocating"
+	StateDownloading = "downloading"
+	StateUploading   = "uploading"
+	StateChecking    = "checking"
+	StateError       = "error"
+	StateStalled     = "stalled"
+	StateQueued      = "queued"
+	StatePaused      = "paused"
+	StateMoving      = "moving"
+)
+
+// Torrent 下载器通用种子信息
+type Torrent struct {
+	Hash       string
+	Name       string
+	Tracker    string   // 主 tracker 地址
+	Category   string   // 分类 或 标签
+	Tags       []string // 标签
+	SavePath   string   // 保存路径
+	State      string   // 统一状态 见 State 常量 无法识别时为下载器原始状态
+	Size       int64    // 选中大小 单位字节
+	Downloaded int64    // 已下载 单位字节
+	Uploaded   int64    // 已上传 单位字节
+
+	DownloadSpeed int64   // 当前下载速度 单位字节
+	UploadSpeed   int64   // 当前上传速度 单位字节
+	Ratio         float64 // 分享率
+	Progress      float64 // 下载进度 0-1
+
+	Seeds         int64 // 已连接做种者
+	SeedsTotal    int64 // tracker 报告的做种者
+	Leechers      int64 // 已连接下载者
+	LeechersTotal int64 // tracker 报告的下载者
+	NoPeers       bool  // 下载器不提供连接与 swarm 数据
+
+	AddedOn      int64 // 添加时间 unix 时间戳 未知时为 0
+	CompletedOn  int64 // 完成时间 未完成时为 0
+	LastActivity int64 // 最后活动时间
+	SeenComplete int64 // 最后一次见到完整种子的时间
+	ActiveTime   int64 // 累计活动时间 单位秒
+	SeedingTime  int64 // 累计做种时间 单位秒
+	NoTimes      bool  // 下载器不提供时间数据
+}
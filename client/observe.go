@@ -0,0 +1,123 @@
+package client
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"github.com/hekmon/transmissionrpc/v2"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrAuth 认证失败 如用户名密码错误、会话过期、IP 被封禁
+var ErrAuth = errors.New("认证失败")
+
+// 接口请求错误类型 用于 exporter 自身指标
+const (
+	ErrorKindNetwork    = "network"     // 连接失败、超时
+	ErrorKindHTTPStatus = "http_status" // 非 200 状态码
+	ErrorKindDecode     = "decode"      // 返回数据无法解析
+	ErrorKindAuth       = "auth"        // 认证失败
+	ErrorKindOther      = "other"       // 下载器返回的其他错误
+)
+
+// Observer 记录下载器的接口请求及登录 由 collector 提供
+type Observer interface {
+	// ObserveRequest endpoint 为接口路径或 RPC 方法名 err 为 nil 时请求成功
+	ObserveRequest(endpoint string, duration time.Duration, err error)
+	// ObserveLogin 每次登录尝试调用一次
+	ObserveLogin(err error)
+}
+
+// ObserverSetter 支持记录接口请求的下载器实现该接口
+type ObserverSetter interface {
+	SetObserver(o Observer)
+}
+
+// instrument 嵌入到下载器中记录接口请求
+// 设置 Observer 之前的记录 如创建下载器时的初次登录 暂存到设置时补记
+type instrument struct {
+	observerMutex sync.Mutex
+	observer      Observer
+	pending       []func(Observer)
+}
+
+// SetObserver 需要在开始轮询前调用
+func (i *instrument) SetObserver(o Observer) {
+	i.observerMutex.Lock()
+	defer i.observerMutex.Unlock()
+	i.observer = o
+	for _, f := range i.pending {
+		f(o)
+	}
+	i.pending = nil
+}
+
+// record 可能在并发请求中调用
+func (i *instrument) record(f func(Observer)) {
+	i.observerMutex.Lock()
+	observer := i.observer
+	if observer == nil {
+		i.pending = append(i.pending, f)
+	}
+	i.observerMutex.Unlock()
+	if observer != nil {
+		f(observer)
+	}
+}
+
+func (i *instrument) observe(endpoint string, start time.Time, err error) {
+	duration := time.Since(start)
+	i.record(func(o Observer) { o.ObserveRequest(endpoint, duration, err) })
+}
+
+func (i *instrument) observeLogin(err error) {
+	i.record(func(o Observer) { o.ObserveLogin(err) })
+}
+
+// StatusError 下载器返回非 200 状态码
+type StatusError struct {
+	Message string
+	Code    int
+}
+
+func (e *StatusError) Error() string {
+	return e.Message + "状态码非200 状态码为:" + strconv.Itoa(e.Code)
+}
+
+// ErrorKind 错误类型 见 ErrorKind 常量
+func ErrorKind(err error) string {
+	var statusErr *StatusError
+	var trStatus transmissionrpc.HTTPStatusCode
+	var netErr net.Error
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var xmlErr *xml.SyntaxError
+	switch {
+	case errors.Is(err, ErrAuth):
+		return ErrorKindAuth
+	case errors.As(err, &statusErr):
+		return httpStatusKind(statusErr.Code)
+	case errors.As(err, &trStatus):
+		return httpStatusKind(int(trStatus))
+	case errors.As(err, &netErr):
+		return ErrorKindNetwork
+	// 返回内容为空或不完整
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr), errors.As(err, &xmlErr),
+		errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return ErrorKindDecode
+	default:
+		return ErrorKindOther
+	}
+}
+
+// httpStatusKind 401、403 为认证失败 qBittorrent 会话过期时返回 403
+func httpStatusKind(code int) string {
+	if code == 401 || code == 403 {
+		return ErrorKindAuth
+	}
+	return ErrorKindHTTPStatus
+}
@@ -2,7 +2,6 @@ package client
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
 	"github.com/chenpt0809/pt-exporter/global"
 	"go.uber.org/zap"
@@ -10,22 +9,44 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
 type QbittorrentClient struct {
-	client      *http.Client
-	Address     string
-	Username    string
-	Password    string
-	baseURL     string
-	sid         string
-	IsLogin     bool
-	statusReq   *http.Request
-	torrentReq  *http.Request
-	mainDataReq *http.Request
+	instrument
+	client     *http.Client
+	Address    string
+	Username   string
+	Password   string
+	baseURL    string
+	sid        string
+	IsLogin    bool
+	statusReq  *http.Request
+	torrentReq *http.Request
+	mainData   QbittirrentMainData // 增量合并后的完整数据
+	rid        int                 // 上一次 sync/maindata 返回的 rid
+	changed    map[string]struct{} // 上次获取 tracker 后 maindata 中有变化的种子
+	trackers   map[string]qbittorrentTrackerCache
+	primary    map[string]string // 种子最近一次的主 tracker 空字符串为确实没有 tracker
 }
 
+// qbittorrentTrackerCache 单个种子的 tracker 状态缓存
+type qbittorrentTrackerCache struct {
+	statuses []TrackerStatus
+	time     time.Time
+}
+
+const (
+	// 同时请求 tracker 列表的数量
+	qbittorrentTrackerWorkers = 8
+	// 没有变化的种子也会在超过该时长后重新获取 tracker
+	qbittorrentTrackerMaxAge = 5 * time.Minute
+	// 每次轮询最多为多少个 tracker 字段为空的种子单独获取主 tracker 其余在之后的轮询中获取
+	qbittorrentPrimaryTrackerLimit = 200
+)
+
 type QbittorrentStatus struct {
 	Connection        string `json:"connection_status"`
 	DHTNodes          int64  `json:"dht_nodes"`
@@ -66,6 +87,7 @@ type QbittorrentTorrent struct {
 	Ratio                  float64 `json:"ratio"`
 	RatioLimit             int64   `json:"ratio_limit"`
 	SavePath               string  `json:"save_path"`
+	SeedingTime            int64   `json:"seeding_time"`
 	SeedingTimeLimit       int64   `json:"seeding_time_limit"`
 	SeenComplete           int64   `json:"seen_complete"`
 	SeqDownload            bool    `json:"seq_dl"`
@@ -75,7 +97,7 @@ type QbittorrentTorrent struct {
 	Tags                   string  `json:"tags"`
 	TimeActive             int64   `json:"time_active"`
 	TotalSize              int64   `json:"total_size"`
-	Tracker                string  `json:"tracker"`
+	Tracker                string  `json:"tracker"` // 没有正常工作的 tracker 时为空
 	UploadLimit            int64   `json:"up_limit"`
 	Uploaded               int64   `json:"uploaded"`
 	UploadedSession        int64   `json:"uploaded_session"`
@@ -83,43 +105,60 @@ type QbittorrentTorrent struct {
 }
 
 type QbittirrentMainData struct {
-	Rid             int                           `json:"rid"`
-	FullUpdate      bool                          `json:"full_update"`
-	Torrents        map[string]QbittorrentTorrent `json:"torrents"`
-	TorrentsRemoved []string                      `json:"torrents_removed"`
-	Categories      map[string]struct {
-		Name     string `json:"name"`
-		SavePath string `json:"savePath"`
-	} `json:"categories"`
-	CategoriesRemoved []string `json:"categories_removed"`
-	Tags              []string `json:"tags"`
-	TagsRemoved       []string `json:"tags_removed"`
-	ServerState       struct {
-		AlltimeDl            int64  `json:"alltime_dl"`
-		AlltimeUl            int64  `json:"alltime_ul"`
-		AverageTimeQueue     int    `json:"average_time_queue"`
-		ConnectionStatus     string `json:"connection_status"`
-		DhtNodes             int    `json:"dht_nodes"`
-		DlInfoData           int64  `json:"dl_info_data"`
-		DlInfoSpeed          int    `json:"dl_info_speed"`
-		DlRateLimit          int    `json:"dl_rate_limit"`
-		FreeSpaceOnDisk      int64  `json:"free_space_on_disk"`
-		GlobalRatio          string `json:"global_ratio"`
-		QueuedIoJobs         int    `json:"queued_io_jobs"`
-		Queueing             bool   `json:"queueing"`
-		ReadCacheHits        string `json:"read_cache_hits"`
-		ReadCacheOverload    string `json:"read_cache_overload"`
-		RefreshInterval      int    `json:"refresh_interval"`
-		TotalBuffersSize     int64  `json:"total_buffers_size"`
-		TotalPeerConnections int    `json:"total_peer_connections"`
-		TotalQueuedSize      int    `json:"total_queued_size"`
-		TotalWastedSession   int64  `json:"total_wasted_session"`
-		UpInfoData           int64  `json:"up_info_data"`
-		UpInfoSpeed          int    `json:"up_info_speed"`
-		UpRateLimit          int    `json:"up_rate_limit"`
-		UseAltSpeedLimits    bool   `json:"use_alt_speed_limits"`
-		WriteCacheOverload   string `json:"write_cache_overload"`
-	} `json:"server_state"`
+	Rid               int                            `json:"rid"`
+	FullUpdate        bool                           `json:"full_update"`
+	Torrents          map[string]QbittorrentTorrent  `json:"torrents"`
+	TorrentsRemoved   []string                       `json:"torrents_removed"`
+	Categories        map[string]QbittorrentCategory `json:"categories"`
+	CategoriesRemoved []string                       `json:"categories_removed"`
+	Tags              []string                       `json:"tags"`
+	TagsRemoved       []string                       `json:"tags_removed"`
+	ServerState       QbittorrentServerState         `json:"server_state"`
+}
+
+type QbittorrentCategory struct {
+	Name     string `json:"name"`
+	SavePath string `json:"savePath"`
+}
+
+type QbittorrentServerState struct {
+	AlltimeDl            int64  `json:"alltime_dl"`
+	AlltimeUl            int64  `json:"alltime_ul"`
+	AverageTimeQueue     int    `json:"average_time_queue"`
+	ConnectionStatus     string `json:"connection_status"`
+	DhtNodes             int    `json:"dht_nodes"`
+	DlInfoData           int64  `json:"dl_info_data"`
+	DlInfoSpeed          int    `json:"dl_info_speed"`
+	DlRateLimit          int    `json:"dl_rate_limit"`
+	FreeSpaceOnDisk      int64  `json:"free_space_on_disk"`
+	GlobalRatio          string `json:"global_ratio"`
+	QueuedIoJobs         int    `json:"queued_io_jobs"`
+	Queueing             bool   `json:"queueing"`
+	ReadCacheHits        string `json:"read_cache_hits"`
+	ReadCacheOverload    string `json:"read_cache_overload"`
+	RefreshInterval      int    `json:"refresh_interval"`
+	TotalBuffersSize     int64  `json:"total_buffers_size"`
+	TotalPeerConnections int    `json:"total_peer_connections"`
+	TotalQueuedSize      int    `json:"total_queued_size"`
+	TotalWastedSession   int64  `json:"total_wasted_session"`
+	UpInfoData           int64  `json:"up_info_data"`
+	UpInfoSpeed          int    `json:"up_info_speed"`
+	UpRateLimit          int    `json:"up_rate_limit"`
+	UseAltSpeedLimits    bool   `json:"use_alt_speed_limits"`
+	WriteCacheOverload   string `json:"write_cache_overload"`
+}
+
+// qbittorrentMainDataDelta sync/maindata 增量返回 种子、分类和服务器状态只包含变化的字段
+type qbittorrentMainDataDelta struct {
+	Rid               int                        `json:"rid"`
+	FullUpdate        bool                       `json:"full_update"`
+	Torrents          map[string]json.RawMessage `json:"torrents"`
+	TorrentsRemoved   []string                   `json:"torrents_removed"`
+	Categories        map[string]json.RawMessage `json:"categories"`
+	CategoriesRemoved []string                   `json:"categories_removed"`
+	Tags              []string                   `json:"tags"`
+	TagsRemoved       []string                   `json:"tags_removed"`
+	ServerState       json.RawMessage            `json:"server_state"`
 }
 
 type QbittorrentOptions struct {
@@ -132,14 +171,13 @@ type QbittorrentOptions struct {
 func NewQbittorrentClient(Options QbittorrentOptions) *QbittorrentClient {
 	global.Logger.Debug("创建：QbittorrentClient")
 	c := &QbittorrentClient{
-		client:   http.DefaultClient,
+		// 设置请求超时时长 不修改共用的 http.DefaultClient 热加载时其他下载器可能正在请求
+		client:   &http.Client{Timeout: time.Second * time.Duration(Options.RequestTimeOut)},
 		Address:  Options.Url,
 		Username: Options.UserName,
 		Password: Options.Password,
 		baseURL:  fmt.Sprintf("%s/api/v2", Options.Url),
 	}
-	// 设置请求超时时长
-	c.client.Timeout = time.Second * time.Duration(Options.RequestTimeOut)
 	// 尝试登录
 	global.Logger.Debug(fmt.Sprintf("初次登录： %s", Options.Url))
 	if err := c.Login(); err != nil {
@@ -149,17 +187,23 @@ func NewQbittorrentClient(Options QbittorrentOptions) *QbittorrentClient {
 }
 
 // Login 登录
-func (c *QbittorrentClient) Login() error {
+func (c *QbittorrentClient) Login() (err error) {
 	global.Logger.Debug("开始登录")
+	start := time.Now()
+	defer func() {
+		c.observe("auth/login", start, err)
+		c.observeLogin(err)
+	}()
 	loginInfo := url.Values{}
 	loginInfo.Set("username", c.Username)
 	loginInfo.Set("password", c.Password)
-	resp, err := http.PostForm(fmt.Sprintf("%s/auth/login", c.baseURL), loginInfo)
+	resp, err := c.client.PostForm(fmt.Sprintf("%s/auth/login", c.baseURL), loginInfo)
 	if err != nil {
 		global.Logger.Error("登录失败：", zap.Error(err))
 		c.IsLogin = false
 		return err
 	}
+	defer resp.Body.Close()
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		global.Logger.Error("登录失败-解析错误", zap.Error(err))
@@ -168,10 +212,16 @@ func (c *QbittorrentClient) Login() error {
 	}
 	bodyStr := string(body)
 	global.Logger.Debug("登录信息：" + c.Address + " " + bodyStr)
-	if err != nil {
-		global.Logger.Error("登录失败", zap.Error(err))
+	// 403 为登录失败次数过多 IP 被封禁
+	if resp.StatusCode != 200 {
+		global.Logger.Error("登录失败" + c.Address + "状态码非200 状态码为:" + strconv.Itoa(resp.StatusCode))
 		c.IsLogin = false
-		return err
+		return &StatusError{Message: "登录失败" + c.Address, Code: resp.StatusCode}
+	}
+	if bodyStr == "Fails." {
+		global.Logger.Error("登录失败 用户名或密码错误" + c.Address)
+		c.IsLogin = false
+		return fmt.Errorf("登录失败 用户名或密码错误 %s: %w", c.Address, ErrAuth)
 	}
 	for _, cookie := range resp.Cookies() {
 		if cookie.Name == "SID" {
@@ -179,9 +229,8 @@ func (c *QbittorrentClient) Login() error {
 			c.IsLogin = true
 		}
 	}
-	mainDataReq, _ := http.NewRequest("GET", fmt.Sprintf("%s/sync/maindata", c.baseURL), nil)
-	mainDataReq.AddCookie(&http.Cookie{Name: "SID", Value: c.sid})
-	c.mainDataReq = mainDataReq
+	// 新会话需要重新获取完整数据
+	c.rid = 0
 	statusReq, _ := http.NewRequest("GET", fmt.Sprintf("%s/transfer/info", c.baseURL), nil)
 	statusReq.AddCookie(&http.Cookie{Name: "SID", Value: c.sid})
 	c.statusReq = statusReq
@@ -193,9 +242,10 @@ func (c *QbittorrentClient) Login() error {
 }
 
 // GetStatus 获取下载器状态
-func (c *QbittorrentClient) GetStatus() (QbittorrentStatus, error) {
+func (c *QbittorrentClient) GetStatus() (status QbittorrentStatus, err error) {
 	global.Logger.Debug("获取下载器状态" + c.Address)
-	var status QbittorrentStatus
+	start := time.Now()
+	defer func() { c.observe("transfer/info", start, err) }()
 	resp, err := c.client.Do(c.statusReq)
 	if err != nil {
 		global.Logger.Error("请求发送失败" + c.Address)
@@ -204,7 +254,7 @@ func (c *QbittorrentClient) GetStatus() (QbittorrentStatus, error) {
 	if resp.StatusCode != 200 {
 		global.Logger.Error("获取下载器信息失败" + c.Address + "状态码非200 状态码为:" + strconv.Itoa(resp.StatusCode))
 		_ = c.Login()
-		return status, errors.New("获取下载器信息失败" + c.Address + "状态码非200 状态码为:" + strconv.Itoa(resp.StatusCode))
+		return status, &StatusError{Message: "获取下载器信息失败" + c.Address, Code: resp.StatusCode}
 	}
 	defer resp.Body.Close()
 	global.Logger.Debug("解析返回状态" + c.Address)
@@ -217,9 +267,10 @@ func (c *QbittorrentClient) GetStatus() (QbittorrentStatus, error) {
 }
 
 // GetTorrent 获取种子状态
-func (c *QbittorrentClient) GetTorrent() ([]QbittorrentTorrent, error) {
+func (c *QbittorrentClient) GetTorrent() (torrents []QbittorrentTorrent, err error) {
 	global.Logger.Debug("获取种子信息" + c.Address)
-	var torrents []QbittorrentTorrent
+	start := time.Now()
+	defer func() { c.observe("torrents/info", start, err) }()
 	resp, err := c.client.Do(c.torrentReq)
 	if err != nil {
 		global.Logger.Error("获取种子信息失败"+c.Address, zap.Error(err))
@@ -228,7 +279,7 @@ func (c *QbittorrentClient) GetTorrent() ([]QbittorrentTorrent, error) {
 	if resp.StatusCode != 200 {
 		global.Logger.Error("获取种子信息失败" + c.Address + "状态码非200 状态码为:" + strconv.Itoa(resp.StatusCode))
 		_ = c.Login()
-		return torrents, errors.New("获取种子信息失败" + c.Address + "状态码非200 状态码为:" + strconv.Itoa(resp.StatusCode))
+		return torrents, &StatusError{Message: "获取种子信息失败" + c.Address, Code: resp.StatusCode}
 	}
 	defer resp.Body.Close()
 	global.Logger.Debug("解析种子信息" + c.Address)
@@ -240,29 +291,484 @@ func (c *QbittorrentClient) GetTorrent() ([]QbittorrentTorrent, error) {
 	return torrents, err
 }
 
-// GetMainData 获取主要数据
-func (c *QbittorrentClient) GetMainData() (QbittirrentMainData, error) {
-	global.Logger.Debug("获取主要数据" + c.Address)
-	var mainData QbittirrentMainData
-	resp, err := c.client.Do(c.mainDataReq)
+// GetMainData 获取主要数据 使用 rid 请求增量数据并合并到内存中 返回合并后的完整数据
+func (c *QbittorrentClient) GetMainData() (_ QbittirrentMainData, err error) {
+	global.Logger.Debug("获取主要数据" + c.Address + " rid:" + strconv.Itoa(c.rid))
+	start := time.Now()
+	defer func() { c.observe("sync/maindata", start, err) }()
+	mainDataReq, _ := http.NewRequest("GET", fmt.Sprintf("%s/sync/maindata?rid=%d", c.baseURL, c.rid), nil)
+	mainDataReq.AddCookie(&http.Cookie{Name: "SID", Value: c.sid})
+	resp, err := c.client.Do(mainDataReq)
 	if err != nil {
 		global.Logger.Error("获取主要数据失败"+c.Address, zap.Error(err))
-		return mainData, err
+		return c.mainData, err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode == 403 {
 		global.Logger.Error("获取主要数据失败" + c.Address + "状态码非200 状态码为:" + strconv.Itoa(resp.StatusCode))
 		_ = c.Login()
-		return mainData, err
+		return c.mainData, &StatusError{Message: "获取主要数据失败" + c.Address, Code: resp.StatusCode}
 	} else if resp.StatusCode != 200 {
 		global.Logger.Error("获取主要数据失败" + c.Address + "状态码非200 状态码为:" + strconv.Itoa(resp.StatusCode))
-		return mainData, err
+		return c.mainData, &StatusError{Message: "获取主要数据失败" + c.Address, Code: resp.StatusCode}
 	}
-	defer resp.Body.Close()
 	global.Logger.Debug("解析主要数据" + c.Address)
-	if err := json.NewDecoder(resp.Body).Decode(&mainData); err != nil {
+	var delta qbittorrentMainDataDelta
+	if err := json.NewDecoder(resp.Body).Decode(&delta); err != nil {
 		global.Logger.Error("解析种子主要数据"+c.Address, zap.Error(err))
-		return mainData, err
+		return c.mainData, err
+	}
+	if err := c.mergeMainData(delta); err != nil {
+		global.Logger.Error("合并主要数据失败"+c.Address, zap.Error(err))
+		// 合并失败时下次重新获取完整数据
+		c.rid = 0
+		return c.mainData, err
+	}
+	global.Logger.Debug(fmt.Sprintf("获取主要信息完成 %s rid:%d 完整更新:%t 种子数:%d", c.Address, c.rid, delta.FullUpdate, len(c.mainData.Torrents)))
+	return c.mainData, nil
+}
+
+// mergeMainData 将增量数据合并到内存中的完整数据 full_update 为 true 时丢弃旧数据
+func (c *QbittorrentClient) mergeMainData(delta qbittorrentMainDataDelta) error {
+	data := &c.mainData
+	if delta.FullUpdate || c.rid == 0 {
+		*data = QbittirrentMainData{}
+		c.changed = nil
+	}
+	if c.changed == nil {
+		c.changed = make(map[string]struct{})
+	}
+	if data.Torrents == nil {
+		data.Torrents = make(map[string]QbittorrentTorrent)
+	}
+	if data.Categories == nil {
+		data.Categories = make(map[string]QbittorrentCategory)
+	}
+	// 种子 只覆盖返回的字段
+	for hash, raw := range delta.Torrents {
+		torrent := data.Torrents[hash]
+		if err := json.Unmarshal(raw, &torrent); err != nil {
+			return err
+		}
+		data.Torrents[hash] = torrent
+		c.changed[hash] = struct{}{}
+	}
+	for _, hash := range delta.TorrentsRemoved {
+		delete(data.Torrents, hash)
+		delete(c.changed, hash)
+	}
+	// 分类
+	for name, raw := range delta.Categories {
+		category := data.Categories[name]
+		if err := json.Unmarshal(raw, &category); err != nil {
+			return err
+		}
+		data.Categories[name] = category
+	}
+	for _, name := range delta.CategoriesRemoved {
+		delete(data.Categories, name)
+	}
+	// 标签
+	for _, tag := range delta.Tags {
+		if !containsString(data.Tags, tag) {
+			data.Tags = append(data.Tags, tag)
+		}
+	}
+	for _, tag := range delta.TagsRemoved {
+		for i, t := range data.Tags {
+			if t == tag {
+				data.Tags = append(data.Tags[:i], data.Tags[i+1:]...)
+				break
+			}
+		}
+	}
+	// 服务器状态
+	if len(delta.ServerState) > 0 {
+		if err := json.Unmarshal(delta.ServerState, &data.ServerState); err != nil {
+			return err
+		}
+	}
+	data.Rid = delta.Rid
+	data.FullUpdate = delta.FullUpdate
+	data.TorrentsRemoved = delta.TorrentsRemoved
+	data.CategoriesRemoved = delta.CategoriesRemoved
+	data.TagsRemoved = delta.TagsRemoved
+	c.rid = delta.Rid
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Refresh 登录并增量获取主要数据 供 Status、Torrents、FreeSpace 使用
+func (c *QbittorrentClient) Refresh() error {
+	// 判断是否登录 未登录进行登录
+	if !c.IsLogin {
+		if err := c.Login(); err != nil {
+			return err
+		}
+	}
+	if _, err := c.GetMainData(); err != nil {
+		return err
+	}
+	c.resolvePrimaryTrackers()
+	return nil
+}
+
+// resolvePrimaryTrackers 记录每个种子最近一次的主 tracker
+// 暂停的种子及 tracker 暂时无法连接时 maindata 中 tracker 字段为空
+// 未记录过的种子单独获取 tracker 列表 每次轮询最多 qbittorrentPrimaryTrackerLimit 个
+func (c *QbittorrentClient) resolvePrimaryTrackers() {
+	if c.primary == nil {
+		c.primary = make(map[string]string)
+	}
+	for hash := range c.primary {
+		if _, ok := c.mainData.Torrents[hash]; !ok {
+			delete(c.primary, hash)
+		}
+	}
+	var unknown []string
+	for hash, t := range c.mainData.Torrents {
+		if t.Tracker != "" {
+			c.primary[hash] = t.Tracker
+		} else if _, ok := c.primary[hash]; !ok && len(unknown) < qbittorrentPrimaryTrackerLimit {
+			unknown = append(unknown, hash)
+		}
+	}
+	for hash, trackers := range c.fetchTrackers(unknown) {
+		c.primary[hash] = ""
+		if statuses := qbittorrentTrackerStatuses(trackers); len(statuses) > 0 {
+			c.primary[hash] = statuses[0].URL
+		}
+	}
+}
+
+// Status 全局速度与累计流量
+func (c *QbittorrentClient) Status() (Status, error) {
+	return Status{
+		DownloadSpeed:   int64(c.mainData.ServerState.DlInfoSpeed),
+		UploadSpeed:     int64(c.mainData.ServerState.UpInfoSpeed),
+		DownloadedTotal: c.mainData.ServerState.AlltimeDl,
+		UploadedTotal:   c.mainData.ServerState.AlltimeUl,
+	}, nil
+}
+
+// Session server_state 中的会话内部状态 百分比与分享率为字符串 限速为当前生效的值 包含备用速度
+func (c *QbittorrentClient) Session() (Session, error) {
+	state := c.mainData.ServerState
+	return Session{
+		DHTNodes:           int64(state.DhtNodes),
+		PeerConnections:    int64(state.TotalPeerConnections),
+		QueuedIOJobs:       int64(state.QueuedIoJobs),
+		QueuedIOBytes:      int64(state.TotalQueuedSize),
+		AverageTimeQueue:   float64(state.AverageTimeQueue) / 1000,
+		ReadCacheHits:      qbittorrentPercent(state.ReadCacheHits),
+		ReadCacheOverload:  qbittorrentPercent(state.ReadCacheOverload),
+		WriteCacheOverload: qbittorrentPercent(state.WriteCacheOverload),
+		BuffersSize:        state.TotalBuffersSize,
+		WastedSession:      state.TotalWastedSession,
+		GlobalRatio:        qbittorrentFloat(state.GlobalRatio),
+
+		ConnectionStatus:  state.ConnectionStatus,
+		AltSpeedEnabled:   state.UseAltSpeedLimits,
+		DownloadRateLimit: int64(state.DlRateLimit),
+		UploadRateLimit:   int64(state.UpRateLimit),
+	}, nil
+}
+
+// qbittorrentPercent 百分比字符串转换为 0-1 无法解析时为 -1
+func qbittorrentPercent(s string) float64 {
+	v := qbittorrentFloat(s)
+	if v < 0 {
+		return v
+	}
+	return v / 100
+}
+
+// qbittorrentFloat 数字字符串 部分语言环境使用逗号作为小数点 无法解析时为 -1
+func qbittorrentFloat(s string) float64 {
+	v, err := strconv.ParseFloat(strings.Replace(strings.TrimSpace(s), ",", ".", 1), 64)
+	if err != nil || v < 0 {
+		return -1
+	}
+	return v
+}
+
+// Torrents 全部种子
+func (c *QbittorrentClient) Torrents() ([]Torrent, error) {
+	torrents := make([]Torrent, 0, len(c.mainData.Torrents))
+	for hash, t := range c.mainData.Torrents {
+		// maindata 中种子以 hash 为键 部分版本不返回 hash 字段
+		if t.Hash == "" {
+			t.Hash = hash
+		}
+		tracker := t.Tracker
+		if tracker == "" {
+			tracker = c.primary[hash]
+		}
+		torrents = append(torrents, Torrent{
+			Hash:       t.Hash,
+			Name:       t.Name,
+			Tracker:    tracker,
+			Category:   t.Category,
+			Tags:       qbittorrentTags(t.Tags),
+			SavePath:   t.SavePath,
+			State:      qbittorrentState(t.State),
+			Size:       t.Size,
+			Downloaded: t.Downloaded,
+			Uploaded:   t.Uploaded,
+
+			DownloadSpeed: t.DownloadSpeed,
+			UploadSpeed:   t.UploadSpeed,
+			Ratio:         t.Ratio,
+			Progress:      t.Progress,
+			Seeds:         t.NumSeeds,
+			SeedsTotal:    t.NumComplete,
+			Leechers:      t.NumLeechs,
+			LeechersTotal: t.NumIncomplete,
+
+			AddedOn:      t.AddedOn,
+			CompletedOn:  t.CompletionOn,
+			LastActivity: t.LastActivity,
+			SeenComplete: t.SeenComplete,
+			ActiveTime:   t.TimeActive,
+			SeedingTime:  t.SeedingTime,
+		})
+	}
+	return torrents, nil
+}
+
+// FreeSpace 默认下载目录剩余空间
+func (c *QbittorrentClient) FreeSpace() (int64, error) {
+	return c.mainData.ServerState.FreeSpaceOnDisk, nil
+}
+
+// Version 获取 qBittorrent 版本、WebAPI 版本及 libtorrent 版本
+// buildInfo 需要 4.2 以上版本 获取失败时不影响版本号
+func (c *QbittorrentClient) Version() (VersionInfo, error) {
+	version, err := c.getApp("version")
+	if err != nil {
+		return VersionInfo{}, err
+	}
+	info := VersionInfo{Version: string(version)}
+	if apiVersion, err := c.getApp("webapiVersion"); err == nil {
+		info.APIVersion = string(apiVersion)
+	}
+	if body, err := c.getApp("buildInfo"); err == nil {
+		var buildInfo struct {
+			Libtorrent string `json:"libtorrent"`
+		}
+		if json.Unmarshal(body, &buildInfo) == nil {
+			info.Libtorrent = buildInfo.Libtorrent
+		}
+	}
+	return info, nil
+}
+
+// getApp 请求 /app 下的接口
+func (c *QbittorrentClient) getApp(name string) (body []byte, err error) {
+	start := time.Now()
+	defer func() { c.observe("app/"+name, start, err) }()
+	req, _ := http.NewRequest("GET", fmt.Sprintf("%s/app/%s", c.baseURL, name), nil)
+	req.AddCookie(&http.Cookie{Name: "SID", Value: c.sid})
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, &StatusError{Message: "获取版本失败" + c.Address, Code: resp.StatusCode}
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// QbittorrentTracker /torrents/trackers 返回的单个 tracker
+type QbittorrentTracker struct {
+	Url           string      `json:"url"`
+	Status        int         `json:"status"` // 0 禁用 1 未联系 2 工作中 3 更新中 4 未工作
+	Tier          interface{} `json:"tier"`   // DHT、PeX、LSD 为空字符串 新版本为 -1
+	NumPeers      int64       `json:"num_peers"`
+	NumSeeds      int64       `json:"num_seeds"`
+	NumLeeches    int64       `json:"num_leeches"`
+	NumDownloaded int64       `json:"num_downloaded"`
+	Msg           string      `json:"msg"`
+	// qBittorrent 5.0 起提供每个汇报地址的下次汇报时间
+	Endpoints []struct {
+		NextAnnounce int64 `json:"next_announce"`
+	} `json:"endpoints"`
+}
+
+// GetTrackers 获取单个种子的 tracker 列表
+func (c *QbittorrentClient) GetTrackers(hash string) (trackers []QbittorrentTracker, err error) {
+	start := time.Now()
+	defer func() { c.observe("torrents/trackers", start, err) }()
+	req, _ := http.NewRequest("GET", fmt.Sprintf("%s/torrents/trackers?hash=%s", c.baseURL, hash), nil)
+	req.AddCookie(&http.Cookie{Name: "SID", Value: c.sid})
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return trackers, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return trackers, &StatusError{Message: "获取 tracker 信息失败" + c.Address, Code: resp.StatusCode}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&trackers); err != nil {
+		return trackers, err
+	}
+	return trackers, nil
+}
+
+// Trackers 获取 tracker 汇报状态 跳过 DHT、PeX、LSD
+// 只重新获取新增、maindata 中有变化或缓存过期的种子 单个种子获取失败时保留上次的结果
+func (c *QbittorrentClient) Trackers() (map[string][]TrackerStatus, error) {
+	if c.trackers == nil {
+		c.trackers = make(map[string]qbittorrentTrackerCache)
+	}
+	for hash := range c.trackers {
+		if _, ok := c.mainData.Torrents[hash]; !ok {
+			delete(c.trackers, hash)
+		}
+	}
+	now := time.Now()
+	var hashes []string
+	for hash := range c.mainData.Torrents {
+		cache, ok := c.trackers[hash]
+		if _, changed := c.changed[hash]; ok && !changed && now.Sub(cache.time) < qbittorrentTrackerMaxAge {
+			continue
+		}
+		hashes = append(hashes, hash)
+	}
+	for hash, trackers := range c.fetchTrackers(hashes) {
+		c.trackers[hash] = qbittorrentTrackerCache{statuses: qbittorrentTrackerStatuses(trackers), time: now}
+		delete(c.changed, hash)
+	}
+	result := make(map[string][]TrackerStatus, len(c.trackers))
+	for hash, cache := range c.trackers {
+		result[hash] = cache.statuses
+	}
+	return result, nil
+}
+
+// fetchTrackers 并发获取多个种子的 tracker 列表 获取失败的种子不在结果中
+func (c *QbittorrentClient) fetchTrackers(hashes []string) map[string][]QbittorrentTracker {
+	result := make(map[string][]QbittorrentTracker, len(hashes))
+	queue := make(chan string)
+	go func() {
+		defer close(queue)
+		for _, hash := range hashes {
+			queue <- hash
+		}
+	}()
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < qbittorrentTrackerWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for hash := range queue {
+				trackers, err := c.GetTrackers(hash)
+				if err != nil {
+					// 种子可能在获取 maindata 后被删除
+					global.Logger.Debug(fmt.Sprintf("获取 tracker 信息失败 %s %s %v", c.Address, hash, err))
+					continue
+				}
+				mutex.Lock()
+				result[hash] = trackers
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return result
+}
+
+// qbittorrentTrackerStatuses 转换为统一的 tracker 状态 跳过禁用的 tracker 及 DHT、PeX、LSD
+func qbittorrentTrackerStatuses(trackers []QbittorrentTracker) []TrackerStatus {
+	statuses := make([]TrackerStatus, 0, len(trackers))
+	for _, t := range trackers {
+		tier, ok := t.Tier.(float64)
+		if !ok || tier < 0 || strings.HasPrefix(t.Url, "** [") || t.Status == 0 {
+			continue
+		}
+		status := TrackerStatus{
+			URL:      t.Url,
+			Tier:     int(tier),
+			Status:   qbittorrentTrackerStatus(t),
+			Message:  t.Msg,
+			Seeders:  t.NumSeeds,
+			Leechers: t.NumLeeches,
+		}
+		for _, e := range t.Endpoints {
+			next := e.NextAnnounce
+			// 兼容返回剩余秒数的版本
+			if next > 0 && next < 1000000000 {
+				next += time.Now().Unix()
+			}
+			if next > 0 && (status.NextAnnounce == 0 || next < status.NextAnnounce) {
+				status.NextAnnounce = next
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// qbittorrentTrackerStatus qBittorrent tracker 状态转换为统一状态
+func qbittorrentTrackerStatus(t QbittorrentTracker) string {
+	switch t.Status {
+	case 1:
+		return TrackerNotContacted
+	case 2:
+		return TrackerOK
+	case 3:
+		return TrackerUpdating
+	default:
+		return classifyTrackerMessage(t.Msg)
+	}
+}
+
+// qbittorrentTags 种子标签以 ", " 分隔
+func qbittorrentTags(tags string) []string {
+	result := make([]string, 0)
+	for _, tag := range strings.Split(tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			result = append(result, tag)
+		}
+	}
+	return result
+}
+
+// qbittorrentState qBittorrent 种子状态转换为统一状态
+// 5.0 起 pausedUP、pausedDL 改名为 stoppedUP、stoppedDL
+func qbittorrentState(state string) string {
+	switch state {
+	case "unknown":
+		return StateUnknown
+	case "allocating":
+		return StateAllocating
+	case "downloading", "metaDL", "forcedMetaDL", "forcedDL":
+		return StateDownloading
+	case "uploading", "forcedUP":
+		return StateUploading
+	case "checkingUP", "checkingDL", "checkingResumeData":
+		return StateChecking
+	case "missingFiles", "error":
+		return StateError
+	case "stalledUP", "stalledDL":
+		return StateStalled
+	case "queuedUP", "queuedDL":
+		return StateQueued
+	case "pausedUP", "pausedDL", "stoppedUP", "stoppedDL":
+		return StatePaused
+	case "moving":
+		return StateMoving
+	default:
+		return state
 	}
-	global.Logger.Debug("获取主要信息完成" + c.Address)
-	return mainData, err
 }
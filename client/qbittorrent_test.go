@@ -0,0 +1,273 @@
+package client
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// applyMainData 依次合并多个 sync/maindata 返回
+func applyMainData(t *testing.T, c *QbittorrentClient, responses ...string) {
+	t.Helper()
+	for _, response := range responses {
+		var delta qbittorrentMainDataDelta
+		if err := json.Unmarshal([]byte(response), &delta); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.mergeMainData(delta); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+const qbittorrentFullMainData = `{
+	"rid": 1,
+	"full_update": true,
+	"torrents": {
+		"aaa": {"name": "a", "tracker": "https://t.site.com/announce", "category": "pt", "uploaded": 100, "upspeed": 10, "state": "uploading"},
+		"bbb": {"name": "b", "tracker": "", "category": "", "uploaded": 5, "state": "pausedUP"}
+	},
+	"categories": {"pt": {"name": "pt", "savePath": "/data/pt"}, "tv": {"name": "tv", "savePath": "/data/tv"}},
+	"tags": ["x", "y"],
+	"server_state": {"alltime_ul": 1000, "alltime_dl": 2000, "dl_info_speed": 1, "up_info_speed": 2, "free_space_on_disk": 500, "global_ratio": "0,50"}
+}`
+
+func TestQbittorrentMergeMainData(t *testing.T) {
+	tests := []struct {
+		name      string
+		responses []string
+		check     func(t *testing.T, data QbittirrentMainData)
+		changed   []string
+	}{
+		{
+			name:      "完整数据",
+			responses: []string{qbittorrentFullMainData},
+			check: func(t *testing.T, data QbittirrentMainData) {
+				if len(data.Torrents) != 2 || data.Torrents["aaa"].Uploaded != 100 || data.Torrents["bbb"].State != "pausedUP" {
+					t.Errorf("种子错误 %+v", data.Torrents)
+				}
+				if data.ServerState.AlltimeUl != 1000 || data.ServerState.GlobalRatio != "0,50" {
+					t.Errorf("服务器状态错误 %+v", data.ServerState)
+				}
+				if data.Rid != 1 || !data.FullUpdate {
+					t.Errorf("rid %d full_update %t", data.Rid, data.FullUpdate)
+				}
+			},
+			changed: []string{"aaa", "bbb"},
+		},
+		{
+			name: "种子只覆盖返回的字段",
+			responses: []string{qbittorrentFullMainData,
+				`{"rid": 2, "torrents": {"aaa": {"upspeed": 0, "uploaded": 150}}}`,
+			},
+			check: func(t *testing.T, data QbittirrentMainData) {
+				a := data.Torrents["aaa"]
+				if a.Uploaded != 150 || a.UploadSpeed != 0 {
+					t.Errorf("变化的字段未更新 %+v", a)
+				}
+				if a.Name != "a" || a.Tracker != "https://t.site.com/announce" || a.Category != "pt" || a.State != "uploading" {
+					t.Errorf("未返回的字段被覆盖 %+v", a)
+				}
+				if data.Torrents["bbb"].Uploaded != 5 {
+					t.Errorf("未返回的种子被修改 %+v", data.Torrents["bbb"])
+				}
+				if data.FullUpdate {
+					t.Error("增量数据 full_update 应为 false")
+				}
+			},
+			changed: []string{"aaa", "bbb"},
+		},
+		{
+			name: "tracker 变为空",
+			responses: []string{qbittorrentFullMainData,
+				`{"rid": 2, "torrents": {"aaa": {"tracker": ""}}}`,
+			},
+			check: func(t *testing.T, data QbittirrentMainData) {
+				if data.Torrents["aaa"].Tracker != "" {
+					t.Errorf("tracker 应为空 %q", data.Torrents["aaa"].Tracker)
+				}
+			},
+			changed: []string{"aaa", "bbb"},
+		},
+		{
+			name: "删除种子",
+			responses: []string{qbittorrentFullMainData,
+				`{"rid": 2, "torrents_removed": ["bbb", "zzz"]}`,
+			},
+			check: func(t *testing.T, data QbittirrentMainData) {
+				if _, ok := data.Torrents["bbb"]; ok || len(data.Torrents) != 1 {
+					t.Errorf("种子未删除 %+v", data.Torrents)
+				}
+				if !reflect.DeepEqual(data.TorrentsRemoved, []string{"bbb", "zzz"}) {
+					t.Errorf("torrents_removed %v", data.TorrentsRemoved)
+				}
+			},
+			changed: []string{"aaa"},
+		},
+		{
+			name: "同一增量中新增和删除",
+			responses: []string{qbittorrentFullMainData,
+				`{"rid": 2, "torrents": {"ccc": {"name": "c", "uploaded": 1}}, "torrents_removed": ["aaa"]}`,
+			},
+			check: func(t *testing.T, data QbittirrentMainData) {
+				if _, ok := data.Torrents["aaa"]; ok {
+					t.Error("种子未删除")
+				}
+				if data.Torrents["ccc"].Name != "c" {
+					t.Errorf("种子未新增 %+v", data.Torrents)
+				}
+			},
+			changed: []string{"bbb", "ccc"},
+		},
+		{
+			name: "服务器状态只覆盖返回的字段",
+			responses: []string{qbittorrentFullMainData,
+				`{"rid": 2, "server_state": {"dl_info_speed": 0, "alltime_ul": 1100}}`,
+			},
+			check: func(t *testing.T, data QbittirrentMainData) {
+				s := data.ServerState
+				if s.DlInfoSpeed != 0 || s.AlltimeUl != 1100 {
+					t.Errorf("变化的字段未更新 %+v", s)
+				}
+				if s.AlltimeDl != 2000 || s.UpInfoSpeed != 2 || s.FreeSpaceOnDisk != 500 || s.GlobalRatio != "0,50" {
+					t.Errorf("未返回的字段被覆盖 %+v", s)
+				}
+			},
+			changed: []string{"aaa", "bbb"},
+		},
+		{
+			name: "没有变化",
+			responses: []string{qbittorrentFullMainData,
+				`{"rid": 2}`,
+			},
+			check: func(t *testing.T, data QbittirrentMainData) {
+				if len(data.Torrents) != 2 || data.ServerState.AlltimeUl != 1000 || data.Rid != 2 {
+					t.Errorf("数据被修改 %+v", data)
+				}
+			},
+			changed: []string{"aaa", "bbb"},
+		},
+		{
+			name: "分类及标签",
+			responses: []string{qbittorrentFullMainData,
+				`{"rid": 2, "categories": {"pt": {"savePath": "/mnt/pt"}, "movie": {"name": "movie", "savePath": "/data/movie"}}, "categories_removed": ["tv"], "tags": ["z", "x"], "tags_removed": ["y"]}`,
+			},
+			check: func(t *testing.T, data QbittirrentMainData) {
+				want := map[string]QbittorrentCategory{
+					"pt":    {Name: "pt", SavePath: "/mnt/pt"},
+					"movie": {Name: "movie", SavePath: "/data/movie"},
+				}
+				if !reflect.DeepEqual(data.Categories, want) {
+					t.Errorf("分类 %+v", data.Categories)
+				}
+				if !reflect.DeepEqual(data.Tags, []string{"x", "z"}) {
+					t.Errorf("标签 %v", data.Tags)
+				}
+			},
+			changed: []string{"aaa", "bbb"},
+		},
+		{
+			name: "full_update 丢弃旧数据",
+			responses: []string{qbittorrentFullMainData,
+				`{"rid": 5, "full_update": true, "torrents": {"ccc": {"name": "c"}}, "server_state": {"alltime_ul": 7}}`,
+			},
+			check: func(t *testing.T, data QbittirrentMainData) {
+				if len(data.Torrents) != 1 || data.Torrents["ccc"].Name != "c" {
+					t.Errorf("旧种子未丢弃 %+v", data.Torrents)
+				}
+				if len(data.Categories) != 0 || len(data.Tags) != 0 {
+					t.Errorf("旧分类或标签未丢弃 %+v %v", data.Categories, data.Tags)
+				}
+				if data.ServerState.AlltimeUl != 7 || data.ServerState.AlltimeDl != 0 {
+					t.Errorf("旧服务器状态未丢弃 %+v", data.ServerState)
+				}
+			},
+			changed: []string{"ccc"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &QbittorrentClient{}
+			applyMainData(t, c, tt.responses...)
+			tt.check(t, c.mainData)
+			changed := make([]string, 0, len(c.changed))
+			for hash := range c.changed {
+				changed = append(changed, hash)
+			}
+			sort.Strings(changed)
+			if !reflect.DeepEqual(changed, tt.changed) {
+				t.Errorf("changed %v, want %v", changed, tt.changed)
+			}
+		})
+	}
+}
+
+func TestQbittorrentMergeMainDataError(t *testing.T) {
+	c := &QbittorrentClient{}
+	applyMainData(t, c, qbittorrentFullMainData)
+	var delta qbittorrentMainDataDelta
+	if err := json.Unmarshal([]byte(`{"rid": 2, "torrents": {"aaa": {"uploaded": "x"}}}`), &delta); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.mergeMainData(delta); err == nil {
+		t.Error("字段类型错误时应返回错误")
+	}
+}
+
+func TestQbittorrentTrackerStatuses(t *testing.T) {
+	var trackers []QbittorrentTracker
+	body := `[
+		{"url": "** [DHT] **", "status": 2, "tier": ""},
+		{"url": "** [PeX] **", "status": 2, "tier": -1},
+		{"url": "** [LSD] **", "status": 1, "tier": -1},
+		{"url": "https://disabled.example/announce", "status": 0, "tier": 0},
+		{"url": "https://t.site.com/announce", "status": 2, "tier": 0, "num_seeds": 3},
+		{"url": "https://backup.site.com/announce", "status": 4, "tier": 1, "msg": "timed out"}
+	]`
+	if err := json.Unmarshal([]byte(body), &trackers); err != nil {
+		t.Fatal(err)
+	}
+	statuses := qbittorrentTrackerStatuses(trackers)
+	if len(statuses) != 2 {
+		t.Fatalf("应跳过 DHT、PeX、LSD 及禁用的 tracker %+v", statuses)
+	}
+	if statuses[0].URL != "https://t.site.com/announce" || statuses[0].Tier != 0 || statuses[0].Status != TrackerOK || statuses[0].Seeders != 3 {
+		t.Errorf("tracker 错误 %+v", statuses[0])
+	}
+	if statuses[1].Tier != 1 || statuses[1].Status != TrackerTimedOut || statuses[1].Message != "timed out" {
+		t.Errorf("tracker 错误 %+v", statuses[1])
+	}
+}
+
+func TestQbittorrentState(t *testing.T) {
+	tests := []struct {
+		state string
+		want  string
+	}{
+		{"downloading", StateDownloading},
+		{"metaDL", StateDownloading},
+		{"forcedMetaDL", StateDownloading},
+		{"forcedDL", StateDownloading},
+		{"uploading", StateUploading},
+		{"forcedUP", StateUploading},
+		{"stalledUP", StateStalled},
+		{"stalledDL", StateStalled},
+		{"queuedUP", StateQueued},
+		{"queuedDL", StateQueued},
+		{"checkingResumeData", StateChecking},
+		{"pausedUP", StatePaused},
+		{"pausedDL", StatePaused},
+		{"stoppedUP", StatePaused},
+		{"stoppedDL", StatePaused},
+		{"missingFiles", StateError},
+		{"moving", StateMoving},
+		{"unknown", StateUnknown},
+		{"newState", "newState"},
+	}
+	for _, tt := range tests {
+		if got := qbittorrentState(tt.state); got != tt.want {
+			t.Errorf("qbittorrentState(%q) = %q, want %q", tt.state, got, tt.want)
+		}
+	}
+}
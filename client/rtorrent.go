@@ -0,0 +1,444 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/chenpt0809/pt-exporter/global"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type RtorrentClient struct {
+	instrument
+	client   *http.Client
+	Address  string
+	UserName string
+	Password string
+	network  string // http 或 tcp、unix (SCGI)
+	endpoint string // http 地址 或 SCGI socket 地址
+	timeout  time.Duration
+	status   RtorrentStatus
+	torrents []RtorrentTorrent
+}
+
+type RtorrentOptions struct {
+	Url            string
+	UserName       string
+	Password       string
+	RequestTimeOut int
+}
+
+type RtorrentTorrent struct {
+	Hash             string
+	Name             string
+	SizeBytes        int64
+	CompletedBytes   int64
+	DownTotal        int64
+	UpTotal          int64
+	DownRate         int64
+	UpRate           int64
+	State            int64 // 0 停止 1 开始
+	IsActive         bool
+	IsOpen           bool
+	Complete         bool
+	IsHashChecking   bool
+	Message          string
+	Label            string // ruTorrent 标签 d.custom1
+	Directory        string
+	FreeDiskspace    int64
+	Ratio            int64 // 千分比
+	PeersComplete    int64 // 已连接做种者
+	PeersAccounted   int64 // 已连接下载者
+	Tracker          string
+	ScrapeComplete   int64 // 主 tracker scrape 做种者
+	ScrapeIncomplete int64
+}
+
+type RtorrentStatus struct {
+	DownRate         int64
+	UpRate           int64
+	DownTotal        int64
+	UpTotal          int64
+	DefaultDirectory string
+}
+
+// rtorrentTorrentFields d.multicall2 请求字段 顺序与 RtorrentTorrent 解析一致
+var rtorrentTorrentFields = []string{
+	"d.hash=", "d.name=", "d.size_bytes=", "d.completed_bytes=", "d.down.total=", "d.up.total=",
+	"d.down.rate=", "d.up.rate=", "d.state=", "d.is_active=", "d.is_open=", "d.complete=",
+	"d.is_hash_checking=", "d.message=", "d.custom1=", "d.directory=", "d.free_diskspace=",
+	"d.ratio=", "d.peers_complete=", "d.peers_accounted=",
+}
+
+// NewRtorrentClient 创建 rTorrent 客户端
+// 支持 http(s)://host/RPC2 (ruTorrent 或 nginx 转发)、scgi://host:port 以及 unix:///path/to/rpc.socket
+func NewRtorrentClient(Options RtorrentOptions) *RtorrentClient {
+	global.Logger.Debug("创建：RtorrentClient")
+	c := &RtorrentClient{
+		Address:  Options.Url,
+		UserName: Options.UserName,
+		Password: Options.Password,
+		timeout:  time.Second * time.Duration(Options.RequestTimeOut),
+	}
+	u, err := url.Parse(Options.Url)
+	if err != nil {
+		global.Logger.Error("无法解析的URL:" + Options.Url)
+		return nil
+	}
+	switch u.Scheme {
+	case "scgi":
+		c.network = "tcp"
+		c.endpoint = u.Host
+	case "unix", "scgi+unix":
+		c.network = "unix"
+		c.endpoint = u.Path
+	default:
+		c.network = "http"
+		c.endpoint = Options.Url
+		c.client = &http.Client{Timeout: c.timeout}
+	}
+	return c
+}
+
+// call 调用 XML-RPC 方法
+func (c *RtorrentClient) call(method string, params ...interface{}) (_ interface{}, err error) {
+	start := time.Now()
+	defer func() { c.observe(method, start, err) }()
+	body, err := xmlrpcEncodeCall(method, params...)
+	if err != nil {
+		return nil, err
+	}
+	var respBody []byte
+	if c.network == "http" {
+		respBody, err = c.doHTTP(body)
+	} else {
+		respBody, err = c.doSCGI(body)
+	}
+	if err != nil {
+		global.Logger.Error("请求发送失败"+c.Address, zap.String("method", method), zap.Error(err))
+		return nil, err
+	}
+	result, err := xmlrpcDecodeResponse(respBody)
+	if err != nil {
+		global.Logger.Error("解析返回数据失败"+c.Address, zap.String("method", method), zap.Error(err))
+		return nil, err
+	}
+	return result, nil
+}
+
+func (c *RtorrentClient) doHTTP(body []byte) ([]byte, error) {
+	req, err := http.NewRequest("POST", c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "text/xml")
+	if c.UserName != "" {
+		req.SetBasicAuth(c.UserName, c.Password)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, &StatusError{Message: "请求失败" + c.Address, Code: resp.StatusCode}
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// doSCGI 通过 SCGI 协议直接与 rTorrent 通信
+func (c *RtorrentClient) doSCGI(body []byte) ([]byte, error) {
+	conn, err := net.DialTimeout(c.network, c.endpoint, c.timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if c.timeout > 0 {
+		_ = conn.SetDeadline(time.Now().Add(c.timeout))
+	}
+	headers := "CONTENT_LENGTH\x00" + strconv.Itoa(len(body)) + "\x00" +
+		"SCGI\x001\x00" +
+		"REQUEST_METHOD\x00POST\x00" +
+		"REQUEST_URI\x00/RPC2\x00"
+	var req bytes.Buffer
+	req.WriteString(strconv.Itoa(len(headers)) + ":" + headers + ",")
+	req.Write(body)
+	if _, err := conn.Write(req.Bytes()); err != nil {
+		return nil, err
+	}
+	// 跳过 SCGI 返回的 HTTP 风格头部
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		if strings.HasPrefix(line, "Status:") && !strings.Contains(line, "200") {
+			return nil, errors.New("请求失败" + c.Address + " " + line)
+		}
+	}
+	return ioutil.ReadAll(reader)
+}
+
+// GetStatus 获取全局速度与流量
+func (c *RtorrentClient) GetStatus() (RtorrentStatus, error) {
+	global.Logger.Debug("获取下载器状态" + c.Address)
+	var status RtorrentStatus
+	methods := []string{
+		"throttle.global_down.rate", "throttle.global_up.rate",
+		"throttle.global_down.total", "throttle.global_up.total",
+		"directory.default",
+	}
+	calls := make([]interface{}, 0, len(methods))
+	for _, m := range methods {
+		calls = append(calls, map[string]interface{}{"methodName": m, "params": []interface{}{""}})
+	}
+	result, err := c.call("system.multicall", calls)
+	if err != nil {
+		return status, err
+	}
+	values, err := rtorrentMulticallValues(result, len(methods))
+	if err != nil {
+		global.Logger.Error("解析客户端状态返回错误"+c.Address, zap.Error(err))
+		return status, err
+	}
+	status.DownRate = xmlrpcInt(values[0])
+	status.UpRate = xmlrpcInt(values[1])
+	status.DownTotal = xmlrpcInt(values[2])
+	status.UpTotal = xmlrpcInt(values[3])
+	status.DefaultDirectory = xmlrpcString(values[4])
+	global.Logger.Debug("获取状态成功" + c.Address)
+	return status, nil
+}
+
+// GetTorrents 通过 d.multicall2 一次获取全部种子 再批量获取主 tracker
+func (c *RtorrentClient) GetTorrents() ([]RtorrentTorrent, error) {
+	global.Logger.Debug("获取种子信息" + c.Address)
+	params := []interface{}{"", "main"}
+	for _, f := range rtorrentTorrentFields {
+		params = append(params, f)
+	}
+	result, err := c.call("d.multicall2", params...)
+	if err != nil {
+		return nil, err
+	}
+	rows, ok := result.([]interface{})
+	if !ok {
+		return nil, errors.New("解析种子信息失败" + c.Address)
+	}
+	torrents := make([]RtorrentTorrent, 0, len(rows))
+	for _, row := range rows {
+		v, ok := row.([]interface{})
+		if !ok || len(v) != len(rtorrentTorrentFields) {
+			return nil, errors.New("解析种子信息失败" + c.Address)
+		}
+		label, err := url.QueryUnescape(xmlrpcString(v[14]))
+		if err != nil {
+			label = xmlrpcString(v[14])
+		}
+		torrents = append(torrents, RtorrentTorrent{
+			Hash:           xmlrpcString(v[0]),
+			Name:           xmlrpcString(v[1]),
+			SizeBytes:      xmlrpcInt(v[2]),
+			CompletedBytes: xmlrpcInt(v[3]),
+			DownTotal:      xmlrpcInt(v[4]),
+			UpTotal:        xmlrpcInt(v[5]),
+			DownRate:       xmlrpcInt(v[6]),
+			UpRate:         xmlrpcInt(v[7]),
+			State:          xmlrpcInt(v[8]),
+			IsActive:       xmlrpcInt(v[9]) == 1,
+			IsOpen:         xmlrpcInt(v[10]) == 1,
+			Complete:       xmlrpcInt(v[11]) == 1,
+			IsHashChecking: xmlrpcInt(v[12]) == 1,
+			Message:        xmlrpcString(v[13]),
+			Label:          label,
+			Directory:      xmlrpcString(v[15]),
+			FreeDiskspace:  xmlrpcInt(v[16]),
+			Ratio:          xmlrpcInt(v[17]),
+			PeersComplete:  xmlrpcInt(v[18]),
+			PeersAccounted: xmlrpcInt(v[19]),
+		})
+	}
+	if len(torrents) > 0 {
+		if err := c.fillTrackers(torrents); err != nil {
+			global.Logger.Error("获取tracker信息失败"+c.Address, zap.Error(err))
+			return nil, err
+		}
+	}
+	global.Logger.Debug("获取种子信息完成" + c.Address)
+	return torrents, nil
+}
+
+// rtorrentMulticallBatch 每次 system.multicall 获取 tracker 的种子数 避免种子较多时单个请求过大
+const rtorrentMulticallBatch = 500
+
+// fillTrackers 通过 system.multicall 分批获取每个种子的第一个 tracker
+func (c *RtorrentClient) fillTrackers(torrents []RtorrentTorrent) error {
+	for start := 0; start < len(torrents); start += rtorrentMulticallBatch {
+		end := start + rtorrentMulticallBatch
+		if end > len(torrents) {
+			end = len(torrents)
+		}
+		if err := c.fillTrackersBatch(torrents[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *RtorrentClient) fillTrackersBatch(torrents []RtorrentTorrent) error {
+	methods := []string{"t.url", "t.scrape_complete", "t.scrape_incomplete"}
+	calls := make([]interface{}, 0, len(torrents)*len(methods))
+	for _, t := range torrents {
+		for _, m := range methods {
+			calls = append(calls, map[string]interface{}{"methodName": m, "params": []interface{}{t.Hash + ":t0"}})
+		}
+	}
+	result, err := c.call("system.multicall", calls)
+	if err != nil {
+		return err
+	}
+	values, err := rtorrentMulticallValues(result, len(calls))
+	if err != nil {
+		return err
+	}
+	for i := range torrents {
+		v := values[i*len(methods):]
+		torrents[i].Tracker = xmlrpcString(v[0])
+		torrents[i].ScrapeComplete = xmlrpcInt(v[1])
+		torrents[i].ScrapeIncomplete = xmlrpcInt(v[2])
+	}
+	return nil
+}
+
+// rtorrentMulticallValues 展开 system.multicall 的返回 出错的调用返回 nil
+func rtorrentMulticallValues(result interface{}, n int) ([]interface{}, error) {
+	rows, ok := result.([]interface{})
+	if !ok || len(rows) != n {
+		return nil, fmt.Errorf("system.multicall 返回数量不匹配 期望 %d", n)
+	}
+	values := make([]interface{}, n)
+	for i, row := range rows {
+		if v, ok := row.([]interface{}); ok && len(v) > 0 {
+			values[i] = v[0]
+		}
+	}
+	return values, nil
+}
+
+// Refresh 获取全局状态与全部种子
+func (c *RtorrentClient) Refresh() error {
+	status, err := c.GetStatus()
+	if err != nil {
+		return err
+	}
+	torrents, err := c.GetTorrents()
+	if err != nil {
+		return err
+	}
+	c.status = status
+	c.torrents = torrents
+	return nil
+}
+
+// Status 全局速度与本次会话流量
+func (c *RtorrentClient) Status() (Status, error) {
+	return Status{
+		DownloadSpeed:   c.status.DownRate,
+		UploadSpeed:     c.status.UpRate,
+		DownloadedTotal: c.status.DownTotal,
+		UploadedTotal:   c.status.UpTotal,
+	}, nil
+}
+
+// Torrents 全部种子
+func (c *RtorrentClient) Torrents() ([]Torrent, error) {
+	torrents := make([]Torrent, 0, len(c.torrents))
+	for _, t := range c.torrents {
+		torrent := Torrent{
+			Hash:       t.Hash,
+			Name:       t.Name,
+			Tracker:    t.Tracker,
+			Category:   t.Label,
+			SavePath:   t.Directory,
+			State:      rtorrentState(t),
+			Size:       t.SizeBytes,
+			Downloaded: t.DownTotal,
+			Uploaded:   t.UpTotal,
+
+			DownloadSpeed: t.DownRate,
+			UploadSpeed:   t.UpRate,
+			Ratio:         float64(t.Ratio) / 1000,
+			Seeds:         t.PeersComplete,
+			SeedsTotal:    t.ScrapeComplete,
+			Leechers:      t.PeersAccounted,
+			LeechersTotal: t.ScrapeIncomplete,
+			NoTimes:       true,
+		}
+		if t.SizeBytes > 0 {
+			torrent.Progress = float64(t.CompletedBytes) / float64(t.SizeBytes)
+		}
+		torrents = append(torrents, torrent)
+	}
+	return torrents, nil
+}
+
+// FreeSpace rTorrent 没有全局剩余空间 使用默认目录下种子所在磁盘的剩余空间
+// 未获取到默认目录时无法确定磁盘
+func (c *RtorrentClient) FreeSpace() (int64, error) {
+	if c.status.DefaultDirectory == "" {
+		return 0, ErrNotSupported
+	}
+	for _, t := range c.torrents {
+		if strings.HasPrefix(t.Directory, c.status.DefaultDirectory) {
+			return t.FreeDiskspace, nil
+		}
+	}
+	if len(c.torrents) > 0 {
+		return c.torrents[0].FreeDiskspace, nil
+	}
+	return 0, ErrNotSupported
+}
+
+// Version 获取 rTorrent 版本及 libtorrent 版本
+func (c *RtorrentClient) Version() (VersionInfo, error) {
+	result, err := c.call("system.client_version")
+	if err != nil {
+		return VersionInfo{}, err
+	}
+	info := VersionInfo{Version: xmlrpcString(result)}
+	if result, err := c.call("system.library_version"); err == nil {
+		info.Libtorrent = xmlrpcString(result)
+	}
+	return info, nil
+}
+
+// rtorrentState rTorrent 没有单一状态字段 根据多个标志位推导统一状态
+func rtorrentState(t RtorrentTorrent) string {
+	switch {
+	case t.IsHashChecking:
+		return StateChecking
+	case strings.HasPrefix(t.Message, "Storage error"):
+		return StateError
+	case t.State == 0, !t.IsActive:
+		return StatePaused
+	case t.Complete && t.UpRate > 0:
+		return StateUploading
+	case !t.Complete && t.DownRate > 0:
+		return StateDownloading
+	default:
+		return StateStalled
+	}
+}
@@ -0,0 +1,53 @@
+package client
+
+// SessionReporter 可以提供会话内部状态的下载器实现该接口 目前为 qBittorrent 与 Transmission
+// 与 Status 读取同一次 Refresh 的数据
+type SessionReporter interface {
+	Session() (Session, error)
+}
+
+// Session 下载器会话内部状态 用于排查磁盘瓶颈与连接数耗尽 未知的字段为 -1
+type Session struct {
+	DHTNodes           int64   // DHT 节点数
+	PeerConnections    int64   // 全部连接数
+	QueuedIOJobs       int64   // 排队的磁盘 IO 任务数
+	QueuedIOBytes      int64   // 排队等待写入的数据 单位字节
+	AverageTimeQueue   float64 // 磁盘 IO 任务平均排队时间 单位秒
+	ReadCacheHits      float64 // 读缓存命中率 0-1
+	ReadCacheOverload  float64 // 读缓存过载 0-1
+	WriteCacheOverload float64 // 写缓存过载 0-1
+	BuffersSize        int64   // 缓冲区大小 单位字节
+	WastedSession      int64   // 本次会话浪费的流量 单位字节
+	GlobalRatio        float64 // 全局分享率
+
+	ConnectionStatus  string // 连接状态 见 Connection 常量 未知时为空
+	AltSpeedEnabled   bool   // 是否处于备用速度模式
+	DownloadRateLimit int64  // 当前生效的全局下载限速 单位字节每秒 0 为不限速 未知时为 -1
+	UploadRateLimit   int64  // 当前生效的全局上传限速 单位字节每秒 0 为不限速 未知时为 -1
+}
+
+// 下载器连接状态
+const (
+	ConnectionConnected    = "connected"
+	ConnectionFirewalled   = "firewalled"
+	ConnectionDisconnected = "disconnected"
+)
+
+// unknownSession 全部字段未知的会话状态 只提供部分字段的下载器在此基础上填充
+func unknownSession() Session {
+	return Session{
+		DHTNodes:           -1,
+		PeerConnections:    -1,
+		QueuedIOJobs:       -1,
+		QueuedIOBytes:      -1,
+		AverageTimeQueue:   -1,
+		ReadCacheHits:      -1,
+		ReadCacheOverload:  -1,
+		WriteCacheOverload: -1,
+		BuffersSize:        -1,
+		WastedSession:      -1,
+		GlobalRatio:        -1,
+		DownloadRateLimit:  -1,
+		UploadRateLimit:    -1,
+	}
+}
@@ -0,0 +1,59 @@
+package client
+
+import "strings"
+
+// TrackerReporter 可以获取种子全部 tracker 汇报状态的下载器实现该接口
+// 请求开销较大 仅在开启 tracker 健康检查或 tracker 标签策略为 working、all 时于 Torrents 之后调用
+// qBittorrent 主 tracker 为空时的回退在 Refresh 中单独请求 不经过该接口
+type TrackerReporter interface {
+	// Trackers 以种子 hash 为键的 tracker 列表
+	Trackers() (map[string][]TrackerStatus, error)
+}
+
+// 统一后的 tracker 汇报状态 与 collector 中的状态码一一对应
+const (
+	TrackerNotContacted = "not_contacted"
+	TrackerOK           = "ok"
+	TrackerUpdating     = "updating"
+	TrackerNotWorking   = "not_working"
+	TrackerUnregistered = "unregistered"
+	TrackerTimedOut     = "timed_out"
+)
+
+// TrackerStatus 种子单个 tracker 的汇报状态
+type TrackerStatus struct {
+	URL          string
+	Tier         int
+	Status       string // 统一状态 见 Tracker 常量
+	Message      string // 最后一次汇报返回的消息
+	Seeders      int64  // tracker 报告的做种者 未知时为 -1
+	Leechers     int64  // tracker 报告的下载者 未知时为 -1
+	NextAnnounce int64  // 下次汇报时间 unix 时间戳 未知时为 0
+}
+
+// trackerUnregisteredMessages 站点删除种子时常见的返回消息 统一转为小写匹配
+var trackerUnregisteredMessages = []string{
+	"unregistered", "not registered", "not found", "not exist", "does not exist", "torrent deleted",
+	"torrent has been deleted", "infohash not found", "未注册", "不存在", "已被删除", "已删除",
+}
+
+// trackerTimedOutMessages 连接超时的返回消息
+var trackerTimedOutMessages = []string{
+	"timed out", "timeout", "time out", "超时",
+}
+
+// classifyTrackerMessage 根据汇报失败时的消息区分种子被删除、超时及其他错误
+func classifyTrackerMessage(message string) string {
+	message = strings.ToLower(message)
+	for _, m := range trackerUnregisteredMessages {
+		if strings.Contains(message, m) {
+			return TrackerUnregistered
+		}
+	}
+	for _, m := range trackerTimedOutMessages {
+		if strings.Contains(message, m) {
+			return TrackerTimedOut
+		}
+	}
+	return TrackerNotWorking
+}
@@ -1,12 +1,16 @@
 package client
 
 import (
+	"context"
 	"github.com/chenpt0809/pt-exporter/global"
 	"github.com/chenpt0809/pt-exporter/utils"
 	"github.com/hekmon/transmissionrpc/v2"
+	"strconv"
+	"time"
 )
 
 type TransmissionClient struct {
+	instrument
 	Client   *transmissionrpc.Client
 	Host     string
 	Port     int
@@ -16,8 +20,23 @@ type TransmissionClient struct {
 	baseURL  string
 	sid      string
 	IsLogin  bool
+	trackers map[string][]TrackerStatus // 最近一次 Torrents 获取的 tracker 状态
 }
 
+// transmissionTorrentFields torrent-get 请求字段 避免获取全部字段
+var transmissionTorrentFields = []string{
+	"hashString", "name", "status", "sizeWhenDone", "downloadedEver", "uploadedEver", "trackers", "labels",
+	"rateDownload", "rateUpload", "uploadRatio", "percentDone", "peersSendingToUs", "peersGettingFromUs", "trackerStats",
+	"addedDate", "doneDate", "activityDate", "secondsDownloading", "secondsSeeding", "error",
+	"downloadDir",
+}
+
+// transmissionErrorLocal torrent 的 error 字段 1、2 为 tracker 警告与错误 3 为本地错误 如文件丢失
+const transmissionErrorLocal = 3
+
+// transmissionAnnounceActive trackerStats 的 announceState 0 未激活 1 等待 2 排队 3 正在汇报
+const transmissionAnnounceActive = 3
+
 type TransmissionOptions struct {
 	Url            string
 	UserName       string
@@ -49,3 +68,221 @@ func NewTransmissionClient(Options TransmissionOptions) *TransmissionClient {
 	c.Client = tc
 	return c
 }
+
+// Status 全局速度与累计流量
+func (c *TransmissionClient) Status() (Status, error) {
+	start := time.Now()
+	stats, err := c.Client.SessionStats(context.TODO())
+	c.observe("session-stats", start, err)
+	if err != nil {
+		return Status{}, err
+	}
+	return Status{
+		DownloadSpeed:   stats.DownloadSpeed,
+		UploadSpeed:     stats.UploadSpeed,
+		DownloadedTotal: stats.CumulativeStats.DownloadedBytes,
+		UploadedTotal:   stats.CumulativeStats.UploadedBytes,
+	}, nil
+}
+
+// Torrents 全部种子
+func (c *TransmissionClient) Torrents() ([]Torrent, error) {
+	start := time.Now()
+	trTorrents, err := c.Client.TorrentGet(context.TODO(), transmissionTorrentFields, nil)
+	c.observe("torrent-get", start, err)
+	if err != nil {
+		return nil, err
+	}
+	torrents := make([]Torrent, 0, len(trTorrents))
+	trackers := make(map[string][]TrackerStatus, len(trTorrents))
+	for _, t := range trTorrents {
+		trackers[*t.HashString] = transmissionTrackers(t.TrackerStats)
+		torrent := Torrent{
+			Hash:       *t.HashString,
+			Name:       *t.Name,
+			SavePath:   *t.DownloadDir,
+			State:      transmissionState(t),
+			Size:       int64(t.SizeWhenDone.Byte()),
+			Downloaded: *t.DownloadedEver,
+			Uploaded:   *t.UploadedEver,
+
+			DownloadSpeed: *t.RateDownload,
+			UploadSpeed:   *t.RateUpload,
+			Progress:      *t.PercentDone,
+			Seeds:         *t.PeersSendingToUs,
+			Leechers:      *t.PeersGettingFromUs,
+
+			AddedOn:      t.AddedDate.Unix(),
+			CompletedOn:  t.DoneDate.Unix(),
+			LastActivity: t.ActivityDate.Unix(),
+			SeedingTime:  int64(t.SecondsSeeding.Seconds()),
+		}
+		torrent.ActiveTime = *t.SecondsDownloading + torrent.SeedingTime
+		// -1 无数据 -2 无限
+		if *t.UploadRatio > 0 {
+			torrent.Ratio = *t.UploadRatio
+		}
+		// 多个 tracker 报告的数量取最大值 未汇报时为 -1
+		for _, ts := range t.TrackerStats {
+			if ts.SeederCount > torrent.SeedsTotal {
+				torrent.SeedsTotal = ts.SeederCount
+			}
+			if ts.LeecherCount > torrent.LeechersTotal {
+				torrent.LeechersTotal = ts.LeecherCount
+			}
+		}
+		if len(t.Trackers) > 0 {
+			torrent.Tracker = t.Trackers[0].Announce
+		}
+		if len(t.Labels) > 0 {
+			torrent.Category = t.Labels[0]
+			torrent.Tags = t.Labels
+		}
+		torrents = append(torrents, torrent)
+	}
+	c.trackers = trackers
+	return torrents, nil
+}
+
+// FreeSpace 默认下载目录剩余空间
+func (c *TransmissionClient) FreeSpace() (int64, error) {
+	start := time.Now()
+	downloadDir, err := c.Client.SessionArgumentsGet(context.TODO(), []string{"download-dir"})
+	c.observe("session-get", start, err)
+	if err != nil {
+		return 0, err
+	}
+	return c.PathFreeSpace(*downloadDir.DownloadDir)
+}
+
+// PathFreeSpace 通过 free-space 查询任意目录剩余空间
+func (c *TransmissionClient) PathFreeSpace(path string) (int64, error) {
+	start := time.Now()
+	freeSpace, err := c.Client.FreeSpace(context.TODO(), path)
+	c.observe("free-space", start, err)
+	if err != nil {
+		return 0, err
+	}
+	return int64(freeSpace.Byte()), nil
+}
+
+// Version 获取 Transmission 版本及 RPC 版本
+func (c *TransmissionClient) Version() (VersionInfo, error) {
+	start := time.Now()
+	args, err := c.Client.SessionArgumentsGet(context.TODO(), []string{"version", "rpc-version"})
+	c.observe("session-get", start, err)
+	if err != nil {
+		return VersionInfo{}, err
+	}
+	info := VersionInfo{}
+	if args.Version != nil {
+		info.Version = *args.Version
+	}
+	if args.RPCVersion != nil {
+		info.APIVersion = strconv.FormatInt(*args.RPCVersion, 10)
+	}
+	return info, nil
+}
+
+// transmissionSessionFields session-get 请求字段 限速单位为 KB/s
+var transmissionSessionFields = []string{
+	"alt-speed-enabled", "alt-speed-down", "alt-speed-up",
+	"speed-limit-down-enabled", "speed-limit-down", "speed-limit-up-enabled", "speed-limit-up", "units",
+}
+
+// Session 备用速度模式及当前生效的限速 Transmission 不提供连接状态及磁盘缓存信息
+func (c *TransmissionClient) Session() (Session, error) {
+	start := time.Now()
+	args, err := c.Client.SessionArgumentsGet(context.TODO(), transmissionSessionFields)
+	c.observe("session-get", start, err)
+	if err != nil {
+		return Session{}, err
+	}
+	// speed-bytes 为 1KB 的字节数 默认 1000
+	kb := int64(1000)
+	if args.Units != nil && args.Units.SpeedBytes > 0 {
+		kb = args.Units.SpeedBytes
+	}
+	session := unknownSession()
+	session.AltSpeedEnabled = args.AltSpeedEnabled != nil && *args.AltSpeedEnabled
+	session.DownloadRateLimit = transmissionRateLimit(session.AltSpeedEnabled, args.AltSpeedDown, args.SpeedLimitDownEnabled, args.SpeedLimitDown) * kb
+	session.UploadRateLimit = transmissionRateLimit(session.AltSpeedEnabled, args.AltSpeedUp, args.SpeedLimitUpEnabled, args.SpeedLimitUp) * kb
+	return session, nil
+}
+
+// transmissionRateLimit 备用速度模式下使用备用限速 否则使用开启的全局限速 单位 KB/s
+func transmissionRateLimit(altEnabled bool, altLimit *int64, enabled *bool, limit *int64) int64 {
+	if altEnabled && altLimit != nil {
+		return *altLimit
+	}
+	if enabled != nil && *enabled && limit != nil {
+		return *limit
+	}
+	return 0
+}
+
+// Trackers torrent-get 已包含 trackerStats 直接返回最近一次 Torrents 的结果
+func (c *TransmissionClient) Trackers() (map[string][]TrackerStatus, error) {
+	return c.trackers, nil
+}
+
+// transmissionTrackers trackerStats 转换为统一的 tracker 状态
+func transmissionTrackers(stats []*transmissionrpc.TrackerStats) []TrackerStatus {
+	trackers := make([]TrackerStatus, 0, len(stats))
+	for _, ts := range stats {
+		status := TrackerStatus{
+			URL:      ts.Announce,
+			Tier:     int(ts.Tier),
+			Message:  ts.LastAnnounceResult,
+			Seeders:  ts.SeederCount,
+			Leechers: ts.LeecherCount,
+		}
+		if !ts.NextAnnounceTime.IsZero() && ts.NextAnnounceTime.Unix() > 0 {
+			status.NextAnnounce = ts.NextAnnounceTime.Unix()
+		}
+		switch {
+		case ts.AnnounceState == transmissionAnnounceActive:
+			status.Status = TrackerUpdating
+		case !ts.HasAnnounced:
+			status.Status = TrackerNotContacted
+		case ts.LastAnnounceSucceeded:
+			status.Status = TrackerOK
+		case ts.LastAnnounceTimedOut:
+			status.Status = TrackerTimedOut
+		default:
+			status.Status = classifyTrackerMessage(ts.LastAnnounceResult)
+		}
+		trackers = append(trackers, status)
+	}
+	return trackers
+}
+
+// transmissionState Transmission 种子状态转换为统一状态
+// 与 qBittorrent 一致 本地错误视为错误 下载、做种中但没有传输数据的 peer 视为等待
+func transmissionState(t transmissionrpc.Torrent) string {
+	if *t.Error == transmissionErrorLocal {
+		return StateError
+	}
+	switch status := *t.Status; status {
+	case transmissionrpc.TorrentStatusStopped:
+		return StatePaused
+	case transmissionrpc.TorrentStatusCheckWait, transmissionrpc.TorrentStatusDownloadWait, transmissionrpc.TorrentStatusSeedWait:
+		return StateQueued
+	case transmissionrpc.TorrentStatusCheck:
+		return StateChecking
+	case transmissionrpc.TorrentStatusDownload:
+		if *t.PeersSendingToUs == 0 {
+			return StateStalled
+		}
+		return StateDownloading
+	case transmissionrpc.TorrentStatusSeed:
+		if *t.PeersGettingFromUs == 0 {
+			return StateStalled
+		}
+		return StateUploading
+	case transmissionrpc.TorrentStatusIsolated:
+		return StateStalled
+	default:
+		return status.String()
+	}
+}
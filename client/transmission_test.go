@@ -0,0 +1,56 @@
+package client
+
+import (
+	"github.com/hekmon/transmissionrpc/v2"
+	"testing"
+	"time"
+)
+
+func TestTransmissionTrackers(t *testing.T) {
+	next := time.Unix(1700000600, 0)
+	tests := []struct {
+		name  string
+		stats transmissionrpc.TrackerStats
+		want  TrackerStatus
+	}{
+		{
+			name:  "汇报成功",
+			stats: transmissionrpc.TrackerStats{Announce: "https://t.site.com/announce", HasAnnounced: true, LastAnnounceSucceeded: true, SeederCount: 3, LeecherCount: 1, NextAnnounceTime: next},
+			want:  TrackerStatus{URL: "https://t.site.com/announce", Status: TrackerOK, Seeders: 3, Leechers: 1, NextAnnounce: next.Unix()},
+		},
+		{
+			name:  "正在汇报",
+			stats: transmissionrpc.TrackerStats{Announce: "https://t.site.com/announce", AnnounceState: transmissionAnnounceActive, HasAnnounced: true, SeederCount: -1, LeecherCount: -1},
+			want:  TrackerStatus{URL: "https://t.site.com/announce", Status: TrackerUpdating, Seeders: -1, Leechers: -1},
+		},
+		{
+			name:  "尚未汇报",
+			stats: transmissionrpc.TrackerStats{Announce: "https://backup.site.com/announce", Tier: 1, SeederCount: -1, LeecherCount: -1, NextAnnounceTime: time.Unix(0, 0)},
+			want:  TrackerStatus{URL: "https://backup.site.com/announce", Tier: 1, Status: TrackerNotContacted, Seeders: -1, Leechers: -1},
+		},
+		{
+			name:  "汇报超时",
+			stats: transmissionrpc.TrackerStats{Announce: "https://t.site.com/announce", HasAnnounced: true, LastAnnounceTimedOut: true, LastAnnounceResult: "Tracker did not respond"},
+			want:  TrackerStatus{URL: "https://t.site.com/announce", Status: TrackerTimedOut, Message: "Tracker did not respond"},
+		},
+		{
+			name:  "种子已被站点删除",
+			stats: transmissionrpc.TrackerStats{Announce: "https://t.site.com/announce", HasAnnounced: true, LastAnnounceResult: "Unregistered torrent"},
+			want:  TrackerStatus{URL: "https://t.site.com/announce", Status: TrackerUnregistered, Message: "Unregistered torrent"},
+		},
+		{
+			name:  "其他错误",
+			stats: transmissionrpc.TrackerStats{Announce: "https://t.site.com/announce", HasAnnounced: true, LastAnnounceResult: "passkey invalid"},
+			want:  TrackerStatus{URL: "https://t.site.com/announce", Status: TrackerNotWorking, Message: "passkey invalid"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats := tt.stats
+			got := transmissionTrackers([]*transmissionrpc.TrackerStats{&stats})
+			if len(got) != 1 || got[0] != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,268 @@
+package client
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// xmlrpcEncodeCall 编码 XML-RPC methodCall 请求
+func xmlrpcEncodeCall(method string, params ...interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(`<?xml version="1.0"?><methodCall><methodName>`)
+	if err := xml.EscapeText(&buf, []byte(method)); err != nil {
+		return nil, err
+	}
+	buf.WriteString(`</methodName><params>`)
+	for _, p := range params {
+		buf.WriteString(`<param>`)
+		if err := xmlrpcEncodeValue(&buf, p); err != nil {
+			return nil, err
+		}
+		buf.WriteString(`</param>`)
+	}
+	buf.WriteString(`</params></methodCall>`)
+	return buf.Bytes(), nil
+}
+
+func xmlrpcEncodeValue(buf *bytes.Buffer, v interface{}) error {
+	buf.WriteString(`<value>`)
+	switch val := v.(type) {
+	case string:
+		buf.WriteString(`<string>`)
+		if err := xml.EscapeText(buf, []byte(val)); err != nil {
+			return err
+		}
+		buf.WriteString(`</string>`)
+	case int:
+		buf.WriteString(`<i8>` + strconv.Itoa(val) + `</i8>`)
+	case int64:
+		buf.WriteString(`<i8>` + strconv.FormatInt(val, 10) + `</i8>`)
+	case bool:
+		if val {
+			buf.WriteString(`<boolean>1</boolean>`)
+		} else {
+			buf.WriteString(`<boolean>0</boolean>`)
+		}
+	case []string:
+		buf.WriteString(`<array><data>`)
+		for _, item := range val {
+			if err := xmlrpcEncodeValue(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteString(`</data></array>`)
+	case []interface{}:
+		buf.WriteString(`<array><data>`)
+		for _, item := range val {
+			if err := xmlrpcEncodeValue(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteString(`</data></array>`)
+	case map[string]interface{}:
+		// 按键排序保证请求体稳定
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		buf.WriteString(`<struct>`)
+		for _, k := range keys {
+			buf.WriteString(`<member><name>`)
+			if err := xml.EscapeText(buf, []byte(k)); err != nil {
+				return err
+			}
+			buf.WriteString(`</name>`)
+			if err := xmlrpcEncodeValue(buf, val[k]); err != nil {
+				return err
+			}
+			buf.WriteString(`</member>`)
+		}
+		buf.WriteString(`</struct>`)
+	default:
+		return fmt.Errorf("xmlrpc 不支持的参数类型 %T", v)
+	}
+	buf.WriteString(`</value>`)
+	return nil
+}
+
+// xmlrpcDecodeResponse 解析 XML-RPC methodResponse 返回第一个参数
+func xmlrpcDecodeResponse(body []byte) (interface{}, error) {
+	d := xml.NewDecoder(bytes.NewReader(body))
+	inFault := false
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch se.Name.Local {
+		case "fault":
+			inFault = true
+		case "value":
+			v, err := xmlrpcDecodeValue(d)
+			if err != nil {
+				return nil, err
+			}
+			if inFault {
+				return nil, xmlrpcFault(v)
+			}
+			return v, nil
+		}
+	}
+}
+
+func xmlrpcFault(v interface{}) error {
+	fault, _ := v.(map[string]interface{})
+	return fmt.Errorf("xmlrpc fault %v: %v", fault["faultCode"], fault["faultString"])
+}
+
+// xmlrpcDecodeValue 解析 <value> 内容 调用时 <value> 起始标签已被读取
+func xmlrpcDecodeValue(d *xml.Decoder) (interface{}, error) {
+	var text strings.Builder
+	var result interface{}
+	typed := false
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.CharData:
+			text.Write(t)
+		case xml.StartElement:
+			typed = true
+			switch t.Name.Local {
+			case "array":
+				result, err = xmlrpcDecodeArray(d)
+			case "struct":
+				result, err = xmlrpcDecodeStruct(d)
+			case "nil":
+				result, err = nil, d.Skip()
+			default:
+				var s string
+				if err = d.DecodeElement(&s, &t); err == nil {
+					result, err = xmlrpcParseScalar(t.Name.Local, s)
+				}
+			}
+			if err != nil {
+				return nil, err
+			}
+		case xml.EndElement:
+			// 未指定类型的值按字符串处理
+			if !typed {
+				return text.String(), nil
+			}
+			return result, nil
+		}
+	}
+}
+
+func xmlrpcDecodeArray(d *xml.Decoder) ([]interface{}, error) {
+	result := make([]interface{}, 0)
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Local == "value" {
+				v, err := xmlrpcDecodeValue(d)
+				if err != nil {
+					return nil, err
+				}
+				result = append(result, v)
+			}
+		case xml.EndElement:
+			if t.Name.Local == "array" {
+				return result, nil
+			}
+		}
+	}
+}
+
+func xmlrpcDecodeStruct(d *xml.Decoder) (map[string]interface{}, error) {
+	result := make(map[string]interface{})
+	name := ""
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "name":
+				if err := d.DecodeElement(&name, &t); err != nil {
+					return nil, err
+				}
+			case "value":
+				v, err := xmlrpcDecodeValue(d)
+				if err != nil {
+					return nil, err
+				}
+				result[name] = v
+			}
+		case xml.EndElement:
+			if t.Name.Local == "struct" {
+				return result, nil
+			}
+		}
+	}
+}
+
+func xmlrpcParseScalar(kind string, s string) (interface{}, error) {
+	switch kind {
+	case "i4", "i8", "int":
+		return strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	case "boolean":
+		return strings.TrimSpace(s) == "1", nil
+	case "double":
+		return strconv.ParseFloat(strings.TrimSpace(s), 64)
+	case "string", "base64", "dateTime.iso8601":
+		return s, nil
+	default:
+		return nil, errors.New("xmlrpc 不支持的返回类型 " + kind)
+	}
+}
+
+// xmlrpcInt 将返回值转换为 int64
+func xmlrpcInt(v interface{}) int64 {
+	switch val := v.(type) {
+	case int64:
+		return val
+	case float64:
+		return int64(val)
+	case bool:
+		if val {
+			return 1
+		}
+		return 0
+	case string:
+		i, _ := strconv.ParseInt(val, 10, 64)
+		return i
+	default:
+		return 0
+	}
+}
+
+// xmlrpcString 将返回值转换为 string
+func xmlrpcString(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(val)
+	}
+}
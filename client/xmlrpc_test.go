@@ -0,0 +1,410 @@
+package client
+
+import (
+	"bufio"
+	"github.com/chenpt0809/pt-exporter/global"
+	"go.uber.org/zap"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestXmlrpcEncodeCall(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		params []interface{}
+		want   string
+	}{
+		{
+			name:   "无参数",
+			method: "system.client_version",
+			want:   `<?xml version="1.0"?><methodCall><methodName>system.client_version</methodName><params></params></methodCall>`,
+		},
+		{
+			name:   "标量及转义",
+			method: "d.multicall2",
+			params: []interface{}{"", "a<&>b", 1, int64(-2), true, false},
+			want: `<?xml version="1.0"?><methodCall><methodName>d.multicall2</methodName><params>` +
+				`<param><value><string></string></value></param>` +
+				`<param><value><string>a&lt;&amp;&gt;b</string></value></param>` +
+				`<param><value><i8>1</i8></value></param>` +
+				`<param><value><i8>-2</i8></value></param>` +
+				`<param><value><boolean>1</boolean></value></param>` +
+				`<param><value><boolean>0</boolean></value></param>` +
+				`</params></methodCall>`,
+		},
+		{
+			name:   "数组及结构体",
+			method: "system.multicall",
+			params: []interface{}{[]interface{}{
+				map[string]interface{}{"params": []string{"hash"}, "methodName": "d.name"},
+			}},
+			want: `<?xml version="1.0"?><methodCall><methodName>system.multicall</methodName><params>` +
+				`<param><value><array><data><value><struct>` +
+				`<member><name>methodName</name><value><string>d.name</string></value></member>` +
+				`<member><name>params</name><value><array><data><value><string>hash</string></value></data></array></value></member>` +
+				`</struct></value></data></array></value></param>` +
+				`</params></methodCall>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := xmlrpcEncodeCall(tt.method, tt.params...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+	if _, err := xmlrpcEncodeCall("m", 1.5); err == nil {
+		t.Error("不支持的参数类型应返回错误")
+	}
+}
+
+func TestXmlrpcDecodeResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    interface{}
+		wantErr string
+	}{
+		{
+			name: "整数",
+			body: `<?xml version="1.0"?><methodResponse><params><param><value><i8>1234567890123</i8></value></param></params></methodResponse>`,
+			want: int64(1234567890123),
+		},
+		{
+			name: "i4 带空白",
+			body: "<methodResponse><params><param><value><i4> 42 </i4></value></param></params></methodResponse>",
+			want: int64(42),
+		},
+		{
+			name: "未指定类型按字符串",
+			body: `<methodResponse><params><param><value>0.9.8</value></param></params></methodResponse>`,
+			want: "0.9.8",
+		},
+		{
+			name: "未指定类型的空值",
+			body: `<methodResponse><params><param><value></value></param></params></methodResponse>`,
+			want: "",
+		},
+		{
+			name: "字符串转义",
+			body: `<methodResponse><params><param><value><string>a &amp; b</string></value></param></params></methodResponse>`,
+			want: "a & b",
+		},
+		{
+			name: "布尔及浮点",
+			body: `<methodResponse><params><param><value><array><data>` +
+				`<value><boolean>1</boolean></value><value><boolean>0</boolean></value><value><double>1.5</double></value><value><nil/></value>` +
+				`</data></array></value></param></params></methodResponse>`,
+			want: []interface{}{true, false, 1.5, nil},
+		},
+		{
+			name: "嵌套数组中未指定类型",
+			body: `<methodResponse><params><param><value><array><data>` +
+				`<value><array><data><value>abc</value><value><i8>1</i8></value></data></array></value>` +
+				`</data></array></value></param></params></methodResponse>`,
+			want: []interface{}{[]interface{}{"abc", int64(1)}},
+		},
+		{
+			name: "结构体",
+			body: `<methodResponse><params><param><value><struct>` +
+				`<member><name>a</name><value><i4>1</i4></value></member>` +
+				`<member><name>b</name><value>x</value></member>` +
+				`</struct></value></param></params></methodResponse>`,
+			want: map[string]interface{}{"a": int64(1), "b": "x"},
+		},
+		{
+			name: "fault",
+			body: `<?xml version="1.0"?><methodResponse><fault><value><struct>` +
+				`<member><name>faultCode</name><value><i4>-506</i4></value></member>` +
+				`<member><name>faultString</name><value><string>Method 'foo' not defined</string></value></member>` +
+				`</struct></value></fault></methodResponse>`,
+			wantErr: "xmlrpc fault -506: Method 'foo' not defined",
+		},
+		{
+			name:    "不支持的类型",
+			body:    `<methodResponse><params><param><value><foo>1</foo></value></param></params></methodResponse>`,
+			wantErr: "xmlrpc 不支持的返回类型 foo",
+		},
+		{
+			name:    "数据不完整",
+			body:    `<methodResponse><params><param><value><i8>1`,
+			wantErr: "EOF",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := xmlrpcDecodeResponse([]byte(tt.body))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRtorrentMulticallValues(t *testing.T) {
+	// system.multicall 中每个调用的结果为单元素数组 出错的调用为 fault 结构体
+	body := `<methodResponse><params><param><value><array><data>` +
+		`<value><array><data><value><i8>10</i8></value></data></array></value>` +
+		`<value><struct>` +
+		`<member><name>faultCode</name><value><i4>-501</i4></value></member>` +
+		`<member><name>faultString</name><value><string>Could not find info-hash.</string></value></member>` +
+		`</struct></value>` +
+		`<value><array><data><value>http://tracker.example/announce</value></data></array></value>` +
+		`</data></array></value></param></params></methodResponse>`
+	result, err := xmlrpcDecodeResponse([]byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := rtorrentMulticallValues(result, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{int64(10), nil, "http://tracker.example/announce"}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("got %#v, want %#v", values, want)
+	}
+	if xmlrpcInt(values[1]) != 0 || xmlrpcString(values[1]) != "" {
+		t.Error("出错的调用应转换为零值")
+	}
+	if _, err := rtorrentMulticallValues(result, 2); err == nil {
+		t.Error("返回数量不匹配时应返回错误")
+	}
+}
+
+// scgiServer 启动只处理一次请求的 SCGI 服务 返回收到的头部及请求体
+func scgiServer(t *testing.T, response string) (string, <-chan map[string]string, <-chan string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	headersCh := make(chan map[string]string, 1)
+	bodyCh := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		// 请求格式为 <长度>:<头部>, 头部为 \0 分隔的键值对
+		length, err := reader.ReadString(':')
+		if err != nil {
+			return
+		}
+		n, _ := strconv.Atoi(strings.TrimSuffix(length, ":"))
+		raw := make([]byte, n+1)
+		if _, err := io.ReadFull(reader, raw); err != nil || raw[n] != ',' {
+			return
+		}
+		fields := strings.Split(string(raw[:n]), "\x00")
+		headers := make(map[string]string)
+		for i := 0; i+1 < len(fields); i += 2 {
+			headers[fields[i]] = fields[i+1]
+		}
+		size, _ := strconv.Atoi(headers["CONTENT_LENGTH"])
+		body := make([]byte, size)
+		_, _ = io.ReadFull(reader, body)
+		headersCh <- headers
+		bodyCh <- string(body)
+		_, _ = conn.Write([]byte(response))
+	}()
+	return ln.Addr().String(), headersCh, bodyCh
+}
+
+func TestRtorrentSCGI(t *testing.T) {
+	global.Logger = zap.NewNop()
+	tests := []struct {
+		name     string
+		response string
+		want     interface{}
+		wantErr  string
+	}{
+		{
+			name:     "成功",
+			response: "Status: 200 OK\r\nContent-Type: text/xml\r\nContent-Length: 90\r\n\r\n<methodResponse><params><param><value><string>0.9.8</string></value></param></params></methodResponse>",
+			want:     "0.9.8",
+		},
+		{
+			name:     "无 Status 头部",
+			response: "Content-Type: text/xml\n\n<methodResponse><params><param><value><i8>7</i8></value></param></params></methodResponse>",
+			want:     int64(7),
+		},
+		{
+			name:     "非 200",
+			response: "Status: 500 Internal Server Error\r\n\r\n",
+			wantErr:  "Status: 500",
+		},
+		{
+			name:     "fault",
+			response: "Status: 200 OK\r\n\r\n<methodResponse><fault><value><struct><member><name>faultCode</name><value><i4>-503</i4></value></member><member><name>faultString</name><value><string>Wrong object type.</string></value></member></struct></value></fault></methodResponse>",
+			wantErr:  "xmlrpc fault -503: Wrong object type.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, headersCh, bodyCh := scgiServer(t, tt.response)
+			c := NewRtorrentClient(RtorrentOptions{Url: "scgi://" + addr, RequestTimeOut: 5})
+			got, err := c.call("system.client_version")
+			select {
+			case headers := <-headersCh:
+				body := <-bodyCh
+				if headers["SCGI"] != "1" || headers["REQUEST_METHOD"] != "POST" || headers["CONTENT_LENGTH"] != strconv.Itoa(len(body)) {
+					t.Errorf("SCGI 头部错误 %v", headers)
+				}
+				if !strings.Contains(body, "<methodName>system.client_version</methodName>") {
+					t.Errorf("请求体错误 %s", body)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("未收到请求")
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRtorrentSCGIUnix(t *testing.T) {
+	global.Logger = zap.NewNop()
+	dir, err := ioutil.TempDir("", "pt-exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	socket := dir + "/rpc.socket"
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skip("不支持 unix socket", err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// 读取请求后直接返回
+		reader := bufio.NewReader(conn)
+		length, _ := reader.ReadString(':')
+		n, _ := strconv.Atoi(strings.TrimSuffix(length, ":"))
+		raw := make([]byte, n+1)
+		_, _ = io.ReadFull(reader, raw)
+		fields := strings.Split(string(raw[:n]), "\x00")
+		size, _ := strconv.Atoi(fields[1])
+		_, _ = io.ReadFull(reader, make([]byte, size))
+		_, _ = conn.Write([]byte("Status: 200 OK\r\n\r\n<methodResponse><params><param><value><i8>1</i8></value></param></params></methodResponse>"))
+	}()
+	c := NewRtorrentClient(RtorrentOptions{Url: "unix://" + socket, RequestTimeOut: 5})
+	got, err := c.call("system.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != int64(1) {
+		t.Errorf("got %#v, want 1", got)
+	}
+}
+
+func TestRtorrentFillTrackersBatch(t *testing.T) {
+	global.Logger = zap.NewNop()
+	// 每个请求按 t.url 的数量返回结果 记录每次请求的调用数
+	var calls []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		n := strings.Count(string(body), "<string>t.url</string>")
+		calls = append(calls, n)
+		var b strings.Builder
+		b.WriteString("<methodResponse><params><param><value><array><data>")
+		for i := 0; i < n; i++ {
+			b.WriteString("<value><array><data><value><string>http://tracker.example/announce</string></value></data></array></value>")
+			b.WriteString("<value><array><data><value><i8>3</i8></value></data></array></value>")
+			b.WriteString("<value><array><data><value><i8>1</i8></value></data></array></value>")
+		}
+		b.WriteString("</data></array></value></param></params></methodResponse>")
+		_, _ = w.Write([]byte(b.String()))
+	}))
+	defer server.Close()
+
+	c := NewRtorrentClient(RtorrentOptions{Url: server.URL, RequestTimeOut: 5})
+	torrents := make([]RtorrentTorrent, rtorrentMulticallBatch*2+1)
+	for i := range torrents {
+		torrents[i].Hash = strconv.Itoa(i)
+	}
+	if err := c.fillTrackers(torrents); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(calls, []int{rtorrentMulticallBatch, rtorrentMulticallBatch, 1}) {
+		t.Errorf("每次请求的种子数 %v", calls)
+	}
+	for _, torrent := range torrents {
+		if torrent.Tracker != "http://tracker.example/announce" || torrent.ScrapeComplete != 3 || torrent.ScrapeIncomplete != 1 {
+			t.Fatalf("tracker 错误 %+v", torrent)
+		}
+	}
+}
+
+func TestRtorrentFreeSpace(t *testing.T) {
+	torrents := []RtorrentTorrent{
+		{Directory: "/other/a", FreeDiskspace: 100},
+		{Directory: "/data/pt/b", FreeDiskspace: 200},
+	}
+	tests := []struct {
+		name      string
+		directory string
+		torrents  []RtorrentTorrent
+		want      int64
+		wantErr   bool
+	}{
+		{name: "默认目录下的种子", directory: "/data/pt", torrents: torrents, want: 200},
+		{name: "默认目录下没有种子", directory: "/data/tv", torrents: torrents, want: 100},
+		{name: "未获取到默认目录", directory: "", torrents: torrents, wantErr: true},
+		{name: "没有种子", directory: "/data/pt", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &RtorrentClient{status: RtorrentStatus{DefaultDirectory: tt.directory}, torrents: tt.torrents}
+			got, err := c.FreeSpace()
+			if tt.wantErr {
+				if err != ErrNotSupported {
+					t.Errorf("err = %v, want ErrNotSupported", err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("got %d, %v, want %d", got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package collector
+
+import (
+	"github.com/chenpt0809/pt-exporter/client"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// NoGroupLabel 没有分类或标签的种子汇总到该标签值
+const NoGroupLabel = "none"
+
+// aggregate 一组种子的汇总
+type aggregate struct {
+	torrents      int
+	size          int64
+	downloaded    int64
+	uploaded      int64
+	downloadSpeed int64
+	uploadSpeed   int64
+}
+
+func (a *aggregate) add(t client.Torrent) {
+	a.torrents++
+	a.size += t.Size
+	a.downloaded += t.Downloaded
+	a.uploaded += t.Uploaded
+	a.downloadSpeed += t.DownloadSpeed
+	a.uploadSpeed += t.UploadSpeed
+}
+
+// aggregates 以分组名称为键的汇总
+type aggregates map[string]*aggregate
+
+func (a aggregates) add(group string, t client.Torrent) {
+	if group == "" {
+		group = NoGroupLabel
+	}
+	if _, ok := a[group]; !ok {
+		a[group] = &aggregate{}
+	}
+	a[group].add(t)
+}
+
+// aggregateDescs 按单个标签汇总的指标 如 pt_category_torrents{category="movie"}
+type aggregateDescs struct {
+	torrents           *prometheus.Desc
+	sizeBytes          *prometheus.Desc
+	downloadedBytes    *prometheus.Desc
+	uploadedBytes      *prometheus.Desc
+	downloadSpeedBytes *prometheus.Desc
+	uploadSpeedBytes   *prometheus.Desc
+}
+
+// newAggregateDescs subsystem 为指标名称中间部分 label 为分组标签名 name 为帮助信息中的分组名称
+func newAggregateDescs(namespace string, subsystem string, label string, name string, constLabels prometheus.Labels) aggregateDescs {
+	newDesc := func(metric string, help string) *prometheus.Desc {
+		return prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, metric),
+			"每个"+name+help,
+			[]string{label},
+			constLabels,
+		)
+	}
+	return aggregateDescs{
+		torrents:           newDesc("torrents", "的种子数"),
+		sizeBytes:          newDesc("size_bytes", "的种子总大小 单位字节"),
+		downloadedBytes:    newDesc("downloaded_bytes", "的种子已下载总量 单位字节 种子删除后会减少"),
+		uploadedBytes:      newDesc("uploaded_bytes", "的种子已上传总量 单位字节 种子删除后会减少"),
+		downloadSpeedBytes: newDesc("download_speed_bytes", "的当前下载速度 单位字节"),
+		uploadSpeedBytes:   newDesc("upload_speed_bytes", "的当前上传速度 单位字节"),
+	}
+}
+
+func (d aggregateDescs) describe(descs chan<- *prometheus.Desc) {
+	descs <- d.torrents
+	descs <- d.sizeBytes
+	descs <- d.downloadedBytes
+	descs <- d.uploadedBytes
+	descs <- d.downloadSpeedBytes
+	descs <- d.uploadSpeedBytes
+}
+
+func (d aggregateDescs) collect(metrics chan<- prometheus.Metric, groups aggregates) {
+	for group, a := range groups {
+		metrics <- prometheus.MustNewConstMetric(d.torrents, prometheus.GaugeValue, float64(a.torrents), group)
+		metrics <- prometheus.MustNewConstMetric(d.sizeBytes, prometheus.GaugeValue, float64(a.size), group)
+		metrics <- prometheus.MustNewConstMetric(d.downloadedBytes, prometheus.GaugeValue, float64(a.downloaded), group)
+		metrics <- prometheus.MustNewConstMetric(d.uploadedBytes, prometheus.GaugeValue, float64(a.uploaded), group)
+		metrics <- prometheus.MustNewConstMetric(d.downloadSpeedBytes, prometheus.GaugeValue, float64(a.downloadSpeed), group)
+		metrics <- prometheus.MustNewConstMetric(d.uploadSpeedBytes, prometheus.GaugeValue, float64(a.uploadSpeed), group)
+	}
+}
+
+// collectGroups 按分类及标签汇总 每个种子只计一次 多个标签的种子计入每个标签
+func (c *Collector) collectGroups(metrics chan<- prometheus.Metric, torrents []client.Torrent) {
+	byCategory := make(aggregates)
+	byTag := make(aggregates)
+	for _, torrent := range torrents {
+		byCategory.add(torrent.Category, torrent)
+		if len(torrent.Tags) == 0 {
+			byTag.add(NoGroupLabel, torrent)
+			continue
+		}
+		seen := make(map[string]bool, len(torrent.Tags))
+		for _, tag := range torrent.Tags {
+			if !seen[tag] {
+				seen[tag] = true
+				byTag.add(tag, torrent)
+			}
+		}
+	}
+	c.categoryAggregate.collect(metrics, byCategory)
+	c.tagAggregate.collect(metrics, byTag)
+}
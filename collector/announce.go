@@ -0,0 +1,141 @@
+package collector
+
+import (
+	"github.com/chenpt0809/pt-exporter/client"
+	"github.com/prometheus/client_golang/prometheus"
+	"strconv"
+)
+
+// announceDescs tracker 汇报状态相关指标 开启 TrackerHealth 时创建
+type announceDescs struct {
+	status        *prometheus.Desc
+	seeders       *prometheus.Desc
+	leechers      *prometheus.Desc
+	nextAnnounce  *prometheus.Desc
+	errorTorrents *prometheus.Desc
+}
+
+// trackerErrorStatuses 计入 tracker 错误种子数的状态
+var trackerErrorStatuses = []string{client.TrackerNotWorking, client.TrackerUnregistered, client.TrackerTimedOut}
+
+func newAnnounceDescs(namespace string, constLabels prometheus.Labels) announceDescs {
+	labels := []string{"torrent_hash", "torrent_name", "tracker", "tier"}
+	return announceDescs{
+		// 汇报状态
+		status: prometheus.NewDesc(
+			namespace+"_tracker_announce_status",
+			"tracker 汇报状态",
+			labels,
+			constLabels,
+		),
+		// tracker 报告的做种者
+		seeders: prometheus.NewDesc(
+			namespace+"_tracker_announce_seeders",
+			"tracker 报告的做种者数量",
+			labels,
+			constLabels,
+		),
+		// tracker 报告的下载者
+		leechers: prometheus.NewDesc(
+			namespace+"_tracker_announce_leechers",
+			"tracker 报告的下载者数量",
+			labels,
+			constLabels,
+		),
+		// 下次汇报时间
+		nextAnnounce: prometheus.NewDesc(
+			namespace+"_tracker_announce_next_timestamp_seconds",
+			"下次汇报时间 unix 时间戳",
+			labels,
+			constLabels,
+		),
+		// 每个 tracker 汇报失败的种子数
+		errorTorrents: prometheus.NewDesc(
+			namespace+"_tracker_error_torrents",
+			"tracker 汇报失败的种子数",
+			[]string{"tracker", "status"},
+			constLabels,
+		),
+	}
+}
+
+func (d announceDescs) describe(descs chan<- *prometheus.Desc) {
+	descs <- d.status
+	descs <- d.seeders
+	descs <- d.leechers
+	descs <- d.nextAnnounce
+	descs <- d.errorTorrents
+}
+
+// collectAnnounce 输出每个种子每个 tracker 的汇报状态 以及每个 tracker 汇报失败的种子数
+// series 为需要输出种子维度指标的种子 nil 表示全部 汇报失败的种子数始终统计全部种子
+func (c *Collector) collectAnnounce(metrics chan<- prometheus.Metric, snap *snapshot, series map[string]bool) {
+	d := c.announce
+	// tracker -> 状态 -> 种子数
+	errorTorrents := make(map[string]map[string]int)
+	for _, torrent := range snap.torrents {
+		seen := make(map[string]bool)
+		counted := make(map[string]bool)
+		for _, t := range snap.trackers[torrent.Hash] {
+			tracker := c.trackerHost(t.URL)
+			tier := strconv.Itoa(t.Tier)
+			// 同一 tracker 的多个汇报地址只输出第一个
+			if seen[tracker+"\x00"+tier] {
+				continue
+			}
+			seen[tracker+"\x00"+tier] = true
+			if series == nil || series[torrent.Hash] {
+				labels := []string{torrent.Hash, torrent.Name, tracker, tier}
+				metrics <- prometheus.MustNewConstMetric(d.status, prometheus.GaugeValue, c.RewriteTrackerStatusInt(t.Status), labels...)
+				if t.Seeders >= 0 {
+					metrics <- prometheus.MustNewConstMetric(d.seeders, prometheus.GaugeValue, float64(t.Seeders), labels...)
+				}
+				if t.Leechers >= 0 {
+					metrics <- prometheus.MustNewConstMetric(d.leechers, prometheus.GaugeValue, float64(t.Leechers), labels...)
+				}
+				if t.NextAnnounce > 0 {
+					metrics <- prometheus.MustNewConstMetric(d.nextAnnounce, prometheus.GaugeValue, float64(t.NextAnnounce), labels...)
+				}
+			}
+			if _, ok := errorTorrents[tracker]; !ok {
+				errorTorrents[tracker] = make(map[string]int)
+			}
+			// 种子在同一 tracker 的多个 tier 失败时只计一次
+			if counted[tracker+"\x00"+t.Status] {
+				continue
+			}
+			counted[tracker+"\x00"+t.Status] = true
+			for _, s := range trackerErrorStatuses {
+				if t.Status == s {
+					errorTorrents[tracker][s]++
+				}
+			}
+		}
+	}
+	// 没有失败的 tracker 也输出 0 便于告警
+	for tracker, v := range errorTorrents {
+		for _, s := range trackerErrorStatuses {
+			metrics <- prometheus.MustNewConstMetric(d.errorTorrents, prometheus.GaugeValue, float64(v[s]), tracker, s)
+		}
+	}
+}
+
+// RewriteTrackerStatusInt 统一的 tracker 汇报状态转换为状态码
+func (c *Collector) RewriteTrackerStatusInt(status string) float64 {
+	switch status {
+	case client.TrackerNotContacted:
+		return 0
+	case client.TrackerOK:
+		return 1
+	case client.TrackerUpdating:
+		return 2
+	case client.TrackerNotWorking:
+		return 3
+	case client.TrackerUnregistered:
+		return 4
+	case client.TrackerTimedOut:
+		return 5
+	default:
+		return 10
+	}
+}
@@ -1,37 +1,113 @@
 package collector
 
 import (
+	"github.com/chenpt0809/pt-exporter/client"
 	"github.com/prometheus/client_golang/prometheus"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 )
 
 // Options 可选项
 type Options struct {
-	Lang                 string            // 状态语言 可以选择 zh en 其他报错
-	MaxUpSpeed           int               // 最大上传带宽
-	MaxDownSpeed         int               // 最大下载带宽
-	DownloaderExporter   bool              // 是否使用Downloader_exporter兼容模式
-	RewriteTracker       map[string]string // tracker重写列表
-	UseCategoryAsTracker bool              // 使用分类名称作为tracker
+	Lang                  string            // 状态语言 可以选择 zh en 其他报错
+	MaxUpSpeed            int               // 最大上传带宽 单位字节每秒
+	MaxDownSpeed          int               // 最大下载带宽 单位字节每秒
+	DownloaderExporter    bool              // 是否使用Downloader_exporter兼容模式
+	RewriteTracker        map[string]string // tracker重写列表
+	RewriteRules          []RewriteRule     // tracker重写规则 在 RewriteTracker 之后按顺序匹配
+	UseCategoryAsTracker  bool              // 使用分类名称作为tracker
+	PollInterval          time.Duration     // 后台轮询间隔
+	MaxAge                time.Duration     // 缓存最长有效时间 超过后 up 为 0
+	TrackerHealth         bool              // 获取每个种子全部 tracker 的汇报状态
+	TrackerPolicy         string            // tracker 标签选择策略 见 TrackerPolicy 常量 默认 primary
+	CategoryLabel         bool              // 种子指标添加 category 标签
+	DisableTorrentMetrics bool              // 不输出种子维度的指标 只保留汇总
+	TopTorrents           int               // 只输出当前上传速度最高的 N 个种子的种子维度指标 0 为全部
+	TagsLabel             bool              // 种子指标添加 tags 标签 多个标签以逗号分隔
+	Filters               TorrentFilters    // 种子过滤规则 被过滤的种子不计入任何指标
+	ClientVersion         string            // 兼容模式 version 标签 为空时为 v0.0.0
+	FreeSpacePaths        []string          // 在本机获取剩余空间的目录 下载器与 exporter 在同一台机器时配置
 }
 
+// tracker 标签选择策略
+const (
+	TrackerPolicyPrimary = "primary" // 下载器报告的主 tracker
+	TrackerPolicyWorking = "working" // 第一个汇报正常的 tracker 没有时使用主 tracker
+	TrackerPolicyAll     = "all"     // 每个 tracker 输出一组指标
+)
+
+// NoTrackerLabel 没有 tracker 的种子 如磁力链接、DHT 种子的标签值
+const NoTrackerLabel = "none"
+
+// Collector 通用采集器 通过 client.Downloader 获取数据 所有下载器输出相同的指标
 type Collector struct {
-	up                        prometheus.Gauge
+	clientName                string
+	downloader                client.Downloader
+	Options                   Options
+	mutex                     sync.RWMutex
+	snapshot                  *snapshot
+	stop                      chan struct{}
+	done                      chan struct{}
+	up                        *prometheus.Desc
+	cacheAgeSeconds           *prometheus.Desc
 	downloadBytesTotal        *prometheus.Desc
 	uploadBytesTotal          *prometheus.Desc
-	downloadSpeedBytes        prometheus.Gauge
-	uploadSpeedBytes          prometheus.Gauge
-	freeSpaceOnDisk           prometheus.Gauge
+	downloadSpeedBytes        *prometheus.Desc
+	uploadSpeedBytes          *prometheus.Desc
+	freeSpaceOnDisk           *prometheus.Desc
 	torrent                   *prometheus.Desc
 	torrentSizeBytes          *prometheus.Desc
 	torrentStatus             *prometheus.Desc
 	torrentDownloadBytesTotal *prometheus.Desc
 	torrentUploadBytesTotal   *prometheus.Desc
 	torrentsCount             *prometheus.Desc
-	maxDownloadSpeedBytes     prometheus.Gauge
-	maxUploadSpeedBytes       prometheus.Gauge
+	torrentDownloadSpeedBytes *prometheus.Desc
+	torrentUploadSpeedBytes   *prometheus.Desc
+	torrentRatio              *prometheus.Desc
+	torrentProgress           *prometheus.Desc
+	torrentSeedsConnected     *prometheus.Desc
+	torrentSeedsSwarm         *prometheus.Desc
+	torrentLeechersConnected  *prometheus.Desc
+	torrentLeechersSwarm      *prometheus.Desc
+	torrentAddedTime          *prometheus.Desc
+	torrentCompletedTime      *prometheus.Desc
+	torrentLastActivityTime   *prometheus.Desc
+	torrentSeenCompleteTime   *prometheus.Desc
+	torrentActiveSeconds      *prometheus.Desc
+	torrentSeedingSeconds     *prometheus.Desc
+	maxDownloadSpeedBytes     *prometheus.Desc
+	maxUploadSpeedBytes       *prometheus.Desc
+	downloadUtilizationRatio  *prometheus.Desc
+	uploadUtilizationRatio    *prometheus.Desc
+	announce                  announceDescs
+	session                   sessionDescs
+	clientInfo                *prometheus.Desc
+	version                   *client.VersionInfo // 只在轮询协程中读写
+	versionHandler            func(version string)
+	trackerAggregate          aggregateDescs
+	trackerStateTorrents      *prometheus.Desc
+	categoryAggregate         aggregateDescs
+	tagAggregate              aggregateDescs
+	rewriteRules              []compiledRewriteRule
+	include                   []compiledTorrentFilter
+	exclude                   []compiledTorrentFilter
+	counters                  *CounterStore
+	trackerUploadedTotal      *prometheus.Desc
+	trackerDownloadedTotal    *prometheus.Desc
+	categoryUploadedTotal     *prometheus.Desc
+	categoryDownloadedTotal   *prometheus.Desc
+	pathFreeBytes             *prometheus.Desc
+	pathTorrentBytes          *prometheus.Desc
+	self                      *selfMetrics
+	namespace                 string
+	constLabels               map[string]string // 不含兼容模式的 version 标签
+	descMutex                 sync.RWMutex      // 保护指标描述符 兼容模式下版本变化时替换
 }
 
-func NewCollector(name string, host string, clientType string, o Options) *Collector {
+func NewCollector(name string, host string, clientType string, d client.Downloader, o Options) *Collector {
 	ConstLabels := map[string]string{
 		"name":   name,
 		"host":   host,
@@ -40,118 +116,854 @@ func NewCollector(name string, host string, clientType string, o Options) *Colle
 	namespace := "pt"
 	if o.DownloaderExporter {
 		namespace = "downloader"
+	}
+	// 创建Collector
+	Coll := Collector{
+		clientName:   name,
+		downloader:   d,
+		Options:      o,
+		namespace:    namespace,
+		constLabels:  ConstLabels,
+		rewriteRules: compileRewriteRules(o.RewriteRules),
+		include:      compileTorrentFilters(o.Filters.Include),
+		exclude:      compileTorrentFilters(o.Filters.Exclude),
+	}
+	// 未调用 SetCounterStore 时只在内存中累计
+	Coll.counters, _ = NewCounterStore("")
+	// exporter 自身指标 记录下载器的接口请求 不带 version 标签 版本变化时不重置
+	Coll.self = newSelfMetrics(namespace, ConstLabels)
+	if s, ok := d.(client.ObserverSetter); ok {
+		s.SetObserver(Coll.self)
+	}
+	Coll.newDescs(o.ClientVersion)
+
+	return &Coll
+}
+
+// SetClientVersion 兼容模式下更新 version 标签 轮询及自身指标保持不变
+// 描述符发生变化 需要在注销后、重新注册前调用
+func (c *Collector) SetClientVersion(version string) {
+	c.descMutex.Lock()
+	defer c.descMutex.Unlock()
+	c.newDescs(version)
+}
+
+// newDescs 创建指标描述符 兼容模式下 version 为固定标签 为空时为 v0.0.0
+func (c *Collector) newDescs(version string) {
+	namespace := c.namespace
+	ConstLabels := make(map[string]string, len(c.constLabels)+1)
+	for k, v := range c.constLabels {
+		ConstLabels[k] = v
+	}
+	if c.Options.DownloaderExporter {
 		// 添加版本标签 兼容Downloader_exporter
 		ConstLabels["version"] = "v0.0.0"
+		if version != "" {
+			ConstLabels["version"] = version
+		}
+	}
+	// 种子指标标签 兼容模式下不添加分类及标签
+	torrentLabelNames := []string{"torrent_hash", "torrent_name", "tracker"}
+	if !c.Options.DownloaderExporter && c.Options.CategoryLabel {
+		torrentLabelNames = append(torrentLabelNames, "category")
+	}
+	if !c.Options.DownloaderExporter && c.Options.TagsLabel {
+		torrentLabelNames = append(torrentLabelNames, "tags")
 	}
-	// 创建Collector
-	Coll := Collector{}
 	// 是否可用
-	Coll.up = prometheus.NewGauge(prometheus.GaugeOpts{
-		Namespace:   namespace,
-		Name:        "up",
-		Help:        "客户端是否可用",
-		ConstLabels: ConstLabels,
-	})
+	c.up = prometheus.NewDesc(
+		namespace+"_up",
+		"客户端是否可用",
+		nil,
+		ConstLabels,
+	)
+	// 缓存时长
+	c.cacheAgeSeconds = prometheus.NewDesc(
+		namespace+"_cache_age_seconds",
+		"距离上次成功轮询的时间 单位秒",
+		nil,
+		ConstLabels,
+	)
 	// 总下载量
-	Coll.downloadBytesTotal = prometheus.NewDesc(
+	c.downloadBytesTotal = prometheus.NewDesc(
 		namespace+"_download_bytes_total",
 		"总下载 单位字节",
 		nil,
 		ConstLabels,
 	)
 	// 总上传量
-	Coll.uploadBytesTotal = prometheus.NewDesc(
+	c.uploadBytesTotal = prometheus.NewDesc(
 		namespace+"_upload_bytes_total",
 		"总上传 单位字节",
 		nil,
 		ConstLabels,
 	)
 	// 默认下载地址剩余空间
-	Coll.freeSpaceOnDisk = prometheus.NewGauge(prometheus.GaugeOpts{
-		Namespace:   namespace,
-		Name:        "free_space_on_disk_bytes",
-		Help:        "默认磁盘剩余空间 单位字节",
-		ConstLabels: ConstLabels,
-	})
+	c.freeSpaceOnDisk = prometheus.NewDesc(
+		namespace+"_free_space_on_disk_bytes",
+		"默认磁盘剩余空间 单位字节",
+		nil,
+		ConstLabels,
+	)
 	// 当前全局下载速度
-	Coll.downloadSpeedBytes = prometheus.NewGauge(prometheus.GaugeOpts{
-		Namespace:   namespace,
-		Name:        "download_speed_bytes",
-		Help:        "当前下载速度 单位字节",
-		ConstLabels: ConstLabels,
-	})
+	c.downloadSpeedBytes = prometheus.NewDesc(
+		namespace+"_download_speed_bytes",
+		"当前下载速度 单位字节",
+		nil,
+		ConstLabels,
+	)
 	// 当前全局上传速度
-	Coll.uploadSpeedBytes = prometheus.NewGauge(prometheus.GaugeOpts{
-		Namespace:   namespace,
-		Name:        "upload_speed_bytes",
-		Help:        "当前上传速度 单位字节",
-		ConstLabels: ConstLabels,
-	})
+	c.uploadSpeedBytes = prometheus.NewDesc(
+		namespace+"_upload_speed_bytes",
+		"当前上传速度 单位字节",
+		nil,
+		ConstLabels,
+	)
 	// 种子
-	Coll.torrent = prometheus.NewDesc(
-		fqNameRewrite(namespace+"_tracker_torrent", namespace+"_torrent", o.DownloaderExporter),
+	c.torrent = prometheus.NewDesc(
+		fqNameRewrite(namespace+"_tracker_torrent", namespace+"_torrent", c.Options.DownloaderExporter),
 		"种子",
-		[]string{"torrent_hash", "torrent_name", "tracker"},
+		torrentLabelNames,
 		ConstLabels,
 	)
 	// 种子状态
-	Coll.torrentStatus = prometheus.NewDesc(
-		fqNameRewrite(namespace+"_tracker_torrent_status", namespace+"_torrent_status", o.DownloaderExporter),
+	c.torrentStatus = prometheus.NewDesc(
+		fqNameRewrite(namespace+"_tracker_torrent_status", namespace+"_torrent_status", c.Options.DownloaderExporter),
 		"种子状态",
-		[]string{"torrent_hash", "torrent_name", "tracker"},
+		torrentLabelNames,
 		ConstLabels,
 	)
 	// 种子选中大小
-	Coll.torrentSizeBytes = prometheus.NewDesc(
-		fqNameRewrite(namespace+"_tracker_torrent_size_bytes", namespace+"_torrent_size_bytes", o.DownloaderExporter),
+	c.torrentSizeBytes = prometheus.NewDesc(
+		fqNameRewrite(namespace+"_tracker_torrent_size_bytes", namespace+"_torrent_size_bytes", c.Options.DownloaderExporter),
 		"种子大小 单位字节",
-		[]string{"torrent_hash", "torrent_name", "tracker"},
+		torrentLabelNames,
 		ConstLabels,
 	)
 	// 种子已下载
-	Coll.torrentDownloadBytesTotal = prometheus.NewDesc(
-		fqNameRewrite(namespace+"_tracker_torrent_download_bytes_total", namespace+"_torrent_download_bytes_total", o.DownloaderExporter),
+	c.torrentDownloadBytesTotal = prometheus.NewDesc(
+		fqNameRewrite(namespace+"_tracker_torrent_download_bytes_total", namespace+"_torrent_download_bytes_total", c.Options.DownloaderExporter),
 		"种子已下载 单位字节",
-		[]string{"torrent_hash", "torrent_name", "tracker"},
+		torrentLabelNames,
 		ConstLabels,
 	)
 	// 种子已上传
-	Coll.torrentUploadBytesTotal = prometheus.NewDesc(
-		fqNameRewrite(namespace+"_tracker_torrent_upload_bytes_total", namespace+"_torrent_upload_bytes_total", o.DownloaderExporter),
+	c.torrentUploadBytesTotal = prometheus.NewDesc(
+		fqNameRewrite(namespace+"_tracker_torrent_upload_bytes_total", namespace+"_torrent_upload_bytes_total", c.Options.DownloaderExporter),
 		"种子已上传 单位字节",
-		[]string{"torrent_hash", "torrent_name", "tracker"},
+		torrentLabelNames,
 		ConstLabels,
 	)
-	if o.DownloaderExporter {
-		Coll.torrentsCount = prometheus.NewDesc(
+	if c.Options.DownloaderExporter {
+		c.torrentsCount = prometheus.NewDesc(
 			namespace+"_torrents_count",
 			"种子计数",
 			[]string{"status", "tracker"},
 			ConstLabels,
 		)
 	}
-	// 服务器最大上传带宽
-	if o.MaxDownSpeed != 0 {
-		Coll.maxDownloadSpeedBytes = prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace:   namespace,
-			Name:        "max_download_speed_bytes",
-			Help:        "服务器最大上传带宽 ",
-			ConstLabels: ConstLabels,
-		})
-		Coll.maxDownloadSpeedBytes.Set(float64(o.MaxDownSpeed))
+	// 种子当前下载速度
+	c.torrentDownloadSpeedBytes = prometheus.NewDesc(
+		namespace+"_tracker_torrent_download_speed_bytes",
+		"种子当前下载速度 单位字节",
+		torrentLabelNames,
+		ConstLabels,
+	)
+	// 种子当前上传速度
+	c.torrentUploadSpeedBytes = prometheus.NewDesc(
+		namespace+"_tracker_torrent_upload_speed_bytes",
+		"种子当前上传速度 单位字节",
+		torrentLabelNames,
+		ConstLabels,
+	)
+	// 种子分享率
+	c.torrentRatio = prometheus.NewDesc(
+		namespace+"_tracker_torrent_ratio",
+		"种子分享率",
+		torrentLabelNames,
+		ConstLabels,
+	)
+	// 种子下载进度
+	c.torrentProgress = prometheus.NewDesc(
+		namespace+"_tracker_torrent_progress",
+		"种子下载进度 0-1",
+		torrentLabelNames,
+		ConstLabels,
+	)
+	// 已连接做种者
+	c.torrentSeedsConnected = prometheus.NewDesc(
+		namespace+"_tracker_torrent_seeds_connected",
+		"种子已连接的做种者数量",
+		torrentLabelNames,
+		ConstLabels,
+	)
+	// swarm 做种者
+	c.torrentSeedsSwarm = prometheus.NewDesc(
+		namespace+"_tracker_torrent_seeds_swarm",
+		"tracker 报告的做种者数量",
+		torrentLabelNames,
+		ConstLabels,
+	)
+	// 已连接下载者
+	c.torrentLeechersConnected = prometheus.NewDesc(
+		namespace+"_tracker_torrent_leechers_connected",
+		"种子已连接的下载者数量",
+		torrentLabelNames,
+		ConstLabels,
+	)
+	// swarm 下载者
+	c.torrentLeechersSwarm = prometheus.NewDesc(
+		namespace+"_tracker_torrent_leechers_swarm",
+		"tracker 报告的下载者数量",
+		torrentLabelNames,
+		ConstLabels,
+	)
+	// 种子添加时间
+	c.torrentAddedTime = prometheus.NewDesc(
+		namespace+"_tracker_torrent_added_timestamp_seconds",
+		"种子添加时间 unix 时间戳",
+		torrentLabelNames,
+		ConstLabels,
+	)
+	// 种子完成时间
+	c.torrentCompletedTime = prometheus.NewDesc(
+		namespace+"_tracker_torrent_completed_timestamp_seconds",
+		"种子完成时间 unix 时间戳 未完成时不输出",
+		torrentLabelNames,
+		ConstLabels,
+	)
+	// 种子最后活动时间
+	c.torrentLastActivityTime = prometheus.NewDesc(
+		namespace+"_tracker_torrent_last_activity_timestamp_seconds",
+		"种子最后活动时间 unix 时间戳",
+		torrentLabelNames,
+		ConstLabels,
+	)
+	// 最后一次见到完整种子的时间
+	c.torrentSeenCompleteTime = prometheus.NewDesc(
+		namespace+"_tracker_torrent_seen_complete_timestamp_seconds",
+		"最后一次见到完整种子的时间 unix 时间戳",
+		torrentLabelNames,
+		ConstLabels,
+	)
+	// 种子累计活动时间
+	c.torrentActiveSeconds = prometheus.NewDesc(
+		namespace+"_tracker_torrent_active_seconds",
+		"种子累计活动时间 单位秒",
+		torrentLabelNames,
+		ConstLabels,
+	)
+	// 种子累计做种时间
+	c.torrentSeedingSeconds = prometheus.NewDesc(
+		namespace+"_tracker_torrent_seeding_seconds",
+		"种子累计做种时间 单位秒",
+		torrentLabelNames,
+		ConstLabels,
+	)
+	if c.Options.TrackerHealth {
+		c.announce = newAnnounceDescs(namespace, ConstLabels)
 	}
+	// 下载器版本 兼容模式下 version 为固定标签
+	clientInfoLabelNames := []string{"version", "api_version", "libtorrent_version"}
+	if c.Options.DownloaderExporter {
+		clientInfoLabelNames = clientInfoLabelNames[1:]
+	}
+	c.clientInfo = prometheus.NewDesc(
+		namespace+"_client_info",
+		"下载器版本信息 值始终为 1",
+		clientInfoLabelNames,
+		ConstLabels,
+	)
+	// 会话内部状态
+	if _, ok := c.downloader.(client.SessionReporter); ok {
+		c.session = newSessionDescs(namespace, ConstLabels)
+	}
+	// 按 tracker 汇总
+	c.trackerAggregate = newAggregateDescs(namespace, "tracker", "tracker", "tracker", ConstLabels)
+	c.trackerStateTorrents = prometheus.NewDesc(
+		namespace+"_tracker_state_torrents",
+		"每个 tracker 各状态的种子数",
+		[]string{"tracker", "state"},
+		ConstLabels,
+	)
+	// 按 tracker 及分类的累计流量 种子删除后不会减少
+	c.trackerUploadedTotal = prometheus.NewDesc(
+		namespace+"_tracker_lifetime_uploaded_bytes_total",
+		"每个 tracker 的累计上传 单位字节 种子删除后不会减少",
+		[]string{"tracker"},
+		ConstLabels,
+	)
+	c.trackerDownloadedTotal = prometheus.NewDesc(
+		namespace+"_tracker_lifetime_downloaded_bytes_total",
+		"每个 tracker 的累计下载 单位字节 种子删除后不会减少",
+		[]string{"tracker"},
+		ConstLabels,
+	)
+	c.categoryUploadedTotal = prometheus.NewDesc(
+		namespace+"_category_lifetime_uploaded_bytes_total",
+		"每个分类的累计上传 单位字节 种子删除后不会减少",
+		[]string{"category"},
+		ConstLabels,
+	)
+	c.categoryDownloadedTotal = prometheus.NewDesc(
+		namespace+"_category_lifetime_downloaded_bytes_total",
+		"每个分类的累计下载 单位字节 种子删除后不会减少",
+		[]string{"category"},
+		ConstLabels,
+	)
+	// 按保存路径
+	c.pathFreeBytes = prometheus.NewDesc(
+		namespace+"_path_free_bytes",
+		"保存路径所在磁盘剩余空间 单位字节",
+		[]string{"path"},
+		ConstLabels,
+	)
+	c.pathTorrentBytes = prometheus.NewDesc(
+		namespace+"_path_torrent_bytes",
+		"保存路径下种子已完成的数据量 单位字节",
+		[]string{"path"},
+		ConstLabels,
+	)
+	// 按分类及标签汇总
+	c.categoryAggregate = newAggregateDescs(namespace, "category", "category", "分类", ConstLabels)
+	c.tagAggregate = newAggregateDescs(namespace, "tag", "tag", "标签", ConstLabels)
 	// 服务器最大下载带宽
-	if o.MaxUpSpeed != 0 {
-		Coll.maxUploadSpeedBytes = prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace:   namespace,
-			Name:        "max_upload_speed_bytes",
-			Help:        "服务器最大上传带宽",
-			ConstLabels: ConstLabels,
-		})
-		Coll.maxUploadSpeedBytes.Set(float64(o.MaxDownSpeed))
+	if c.Options.MaxDownSpeed != 0 {
+		c.maxDownloadSpeedBytes = prometheus.NewDesc(
+			namespace+"_max_download_speed_bytes",
+			"服务器最大下载带宽 单位字节",
+			nil,
+			ConstLabels,
+		)
+		// 下载带宽利用率
+		c.downloadUtilizationRatio = prometheus.NewDesc(
+			namespace+"_download_bandwidth_utilization_ratio",
+			"当前下载速度占最大下载带宽的比例",
+			nil,
+			ConstLabels,
+		)
+	}
+	// 服务器最大上传带宽
+	if c.Options.MaxUpSpeed != 0 {
+		c.maxUploadSpeedBytes = prometheus.NewDesc(
+			namespace+"_max_upload_speed_bytes",
+			"服务器最大上传带宽 单位字节",
+			nil,
+			ConstLabels,
+		)
+		// 上传带宽利用率
+		c.uploadUtilizationRatio = prometheus.NewDesc(
+			namespace+"_upload_bandwidth_utilization_ratio",
+			"当前上传速度占最大上传带宽的比例",
+			nil,
+			ConstLabels,
+		)
 	}
 
-	return &Coll
+}
+
+func (c *Collector) Describe(descs chan<- *prometheus.Desc) {
+	c.descMutex.RLock()
+	defer c.descMutex.RUnlock()
+	c.self.describe(descs)
+	descs <- c.up
+	descs <- c.cacheAgeSeconds
+	descs <- c.uploadBytesTotal
+	descs <- c.downloadBytesTotal
+	descs <- c.downloadSpeedBytes
+	descs <- c.uploadSpeedBytes
+	descs <- c.freeSpaceOnDisk
+	descs <- c.clientInfo
+	if _, ok := c.downloader.(client.SessionReporter); ok {
+		c.session.describe(descs)
+	}
+	descs <- c.torrent
+	descs <- c.torrentStatus
+	descs <- c.torrentSizeBytes
+	descs <- c.torrentDownloadBytesTotal
+	descs <- c.torrentUploadBytesTotal
+	if c.Options.DownloaderExporter {
+		descs <- c.torrentsCount
+	} else {
+		descs <- c.torrentDownloadSpeedBytes
+		descs <- c.torrentUploadSpeedBytes
+		descs <- c.torrentRatio
+		descs <- c.torrentProgress
+		descs <- c.torrentSeedsConnected
+		descs <- c.torrentSeedsSwarm
+		descs <- c.torrentLeechersConnected
+		descs <- c.torrentLeechersSwarm
+		descs <- c.torrentAddedTime
+		descs <- c.torrentCompletedTime
+		descs <- c.torrentLastActivityTime
+		descs <- c.torrentSeenCompleteTime
+		descs <- c.torrentActiveSeconds
+		descs <- c.torrentSeedingSeconds
+		if c.Options.TrackerHealth {
+			c.announce.describe(descs)
+		}
+		c.trackerAggregate.describe(descs)
+		descs <- c.trackerStateTorrents
+		descs <- c.trackerUploadedTotal
+		descs <- c.trackerDownloadedTotal
+		descs <- c.categoryUploadedTotal
+		descs <- c.categoryDownloadedTotal
+		descs <- c.pathFreeBytes
+		descs <- c.pathTorrentBytes
+		c.categoryAggregate.describe(descs)
+		c.tagAggregate.describe(descs)
+		if c.Options.MaxDownSpeed != 0 {
+			descs <- c.maxDownloadSpeedBytes
+			descs <- c.downloadUtilizationRatio
+		}
+		if c.Options.MaxUpSpeed != 0 {
+			descs <- c.maxUploadSpeedBytes
+			descs <- c.uploadUtilizationRatio
+		}
+	}
+}
+
+// Collect 读取后台轮询的缓存 不直接请求下载器
+func (c *Collector) Collect(metrics chan<- prometheus.Metric) {
+	c.descMutex.RLock()
+	defer c.descMutex.RUnlock()
+	c.mutex.RLock()
+	snap := c.snapshot
+	c.mutex.RUnlock()
+	c.self.collect(metrics)
+	if !c.Options.DownloaderExporter {
+		if c.Options.MaxDownSpeed != 0 {
+			metrics <- prometheus.MustNewConstMetric(c.maxDownloadSpeedBytes, prometheus.GaugeValue, float64(c.Options.MaxDownSpeed))
+		}
+		if c.Options.MaxUpSpeed != 0 {
+			metrics <- prometheus.MustNewConstMetric(c.maxUploadSpeedBytes, prometheus.GaugeValue, float64(c.Options.MaxUpSpeed))
+		}
+	}
+	// 尚未成功轮询
+	if snap == nil {
+		metrics <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, 0)
+		return
+	}
+	age := time.Since(snap.time)
+	metrics <- prometheus.MustNewConstMetric(c.cacheAgeSeconds, prometheus.GaugeValue, age.Seconds())
+	// 缓存过期
+	if age > c.maxAge() {
+		metrics <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, 0)
+		return
+	}
+	metrics <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, 1)
+
+	status := snap.status
+	if !status.NoTotal {
+		metrics <- prometheus.MustNewConstMetric(
+			c.downloadBytesTotal,
+			prometheus.CounterValue,
+			float64(status.DownloadedTotal),
+		)
+		metrics <- prometheus.MustNewConstMetric(
+			c.uploadBytesTotal,
+			prometheus.CounterValue,
+			float64(status.UploadedTotal),
+		)
+	}
+	metrics <- prometheus.MustNewConstMetric(c.downloadSpeedBytes, prometheus.GaugeValue, float64(status.DownloadSpeed))
+	metrics <- prometheus.MustNewConstMetric(c.uploadSpeedBytes, prometheus.GaugeValue, float64(status.UploadSpeed))
+	// 带宽利用率
+	if !c.Options.DownloaderExporter {
+		if c.Options.MaxDownSpeed != 0 {
+			metrics <- prometheus.MustNewConstMetric(c.downloadUtilizationRatio, prometheus.GaugeValue, float64(status.DownloadSpeed)/float64(c.Options.MaxDownSpeed))
+		}
+		if c.Options.MaxUpSpeed != 0 {
+			metrics <- prometheus.MustNewConstMetric(c.uploadUtilizationRatio, prometheus.GaugeValue, float64(status.UploadSpeed)/float64(c.Options.MaxUpSpeed))
+		}
+	}
+	if snap.hasFreeSpace {
+		metrics <- prometheus.MustNewConstMetric(c.freeSpaceOnDisk, prometheus.GaugeValue, float64(snap.freeSpace))
+	}
+	if v := snap.version; v != nil {
+		labels := []string{v.Version, v.APIVersion, v.Libtorrent}
+		if c.Options.DownloaderExporter {
+			labels = labels[1:]
+		}
+		metrics <- prometheus.MustNewConstMetric(c.clientInfo, prometheus.GaugeValue, 1, labels...)
+	}
+	if snap.hasSession {
+		c.session.collect(metrics, snap.session)
+	}
+	// torrent 相关
+	state := make(map[string]map[string]int)
+	byTracker := make(aggregates)
+	trackerStates := make(map[string]map[string]int)
+	series := c.torrentSeries(snap.torrents)
+	for _, torrent := range snap.torrents {
+		for _, trackerName := range c.trackerNames(torrent, snap.trackers[torrent.Hash]) {
+			// 种子转态重写
+			if c.Options.DownloaderExporter {
+				countState(state, c.RewriteStatusStr(torrent.State), trackerName)
+			} else {
+				byTracker.add(trackerName, torrent)
+				countState(trackerStates, torrent.State, trackerName)
+			}
+			if series == nil || series[torrent.Hash] {
+				c.collectTorrent(metrics, torrent, trackerName)
+			}
+		}
+	}
+	if !c.Options.DownloaderExporter {
+		c.trackerAggregate.collect(metrics, byTracker)
+		for stateName, v := range trackerStates {
+			for tracker, count := range v {
+				metrics <- prometheus.MustNewConstMetric(c.trackerStateTorrents, prometheus.GaugeValue, float64(count), tracker, stateName)
+			}
+		}
+	}
+
+	if !c.Options.DownloaderExporter && c.Options.TrackerHealth && snap.hasTrackers {
+		c.collectAnnounce(metrics, snap, series)
+	}
+	if !c.Options.DownloaderExporter {
+		c.collectGroups(metrics, snap.torrents)
+		c.collectTotals(metrics, snap)
+		c.collectPaths(metrics, snap)
+	}
+
+	for status, v := range state {
+		for tracker, vv := range v {
+			metrics <- prometheus.MustNewConstMetric(
+				c.torrentsCount,
+				prometheus.GaugeValue,
+				float64(vv),
+				status,
+				tracker,
+			)
+		}
+	}
+}
+
+// torrentGauge 种子维度的单个指标值
+type torrentGauge struct {
+	desc  *prometheus.Desc
+	value float64
+}
+
+// collectTorrentTransfer 种子速度、分享率、进度及连接数
+func (c *Collector) collectTorrentTransfer(metrics chan<- prometheus.Metric, torrent client.Torrent, labels []string) {
+	gauges := []torrentGauge{
+		{c.torrentDownloadSpeedBytes, float64(torrent.DownloadSpeed)},
+		{c.torrentUploadSpeedBytes, float64(torrent.UploadSpeed)},
+		{c.torrentRatio, torrent.Ratio},
+		{c.torrentProgress, torrent.Progress},
+	}
+	if !torrent.NoPeers {
+		gauges = append(gauges, []torrentGauge{
+			{c.torrentSeedsConnected, float64(torrent.Seeds)},
+			{c.torrentSeedsSwarm, float64(torrent.SeedsTotal)},
+			{c.torrentLeechersConnected, float64(torrent.Leechers)},
+			{c.torrentLeechersSwarm, float64(torrent.LeechersTotal)},
+		}...)
+	}
+	c.sendTorrentGauges(metrics, gauges, labels)
+}
+
+// collectTorrentTimes 种子时间戳及做种时长 时间戳未知时不输出
+func (c *Collector) collectTorrentTimes(metrics chan<- prometheus.Metric, torrent client.Torrent, labels []string) {
+	if torrent.NoTimes {
+		return
+	}
+	gauges := []torrentGauge{
+		{c.torrentActiveSeconds, float64(torrent.ActiveTime)},
+		{c.torrentSeedingSeconds, float64(torrent.SeedingTime)},
+	}
+	timestamps := []torrentGauge{
+		{c.torrentAddedTime, float64(torrent.AddedOn)},
+		{c.torrentCompletedTime, float64(torrent.CompletedOn)},
+		{c.torrentLastActivityTime, float64(torrent.LastActivity)},
+		{c.torrentSeenCompleteTime, float64(torrent.SeenComplete)},
+	}
+	for _, t := range timestamps {
+		if t.value > 0 {
+			gauges = append(gauges, t)
+		}
+	}
+	c.sendTorrentGauges(metrics, gauges, labels)
+}
+
+// sendTorrentGauges 以种子标签输出一组指标
+func (c *Collector) sendTorrentGauges(metrics chan<- prometheus.Metric, gauges []torrentGauge, labels []string) {
+	for _, g := range gauges {
+		metrics <- prometheus.MustNewConstMetric(
+			g.desc,
+			prometheus.GaugeValue,
+			g.value,
+			labels...,
+		)
+	}
+}
+
+// SetCounterStore 使用共享的累计流量 需要在 Start 之前调用
+func (c *Collector) SetCounterStore(s *CounterStore) {
+	c.counters = s
+}
+
+// SetVersionHandler 获取到下载器版本后调用 f 需要在 Start 之前调用
+// f 在轮询协程中调用 不能阻塞或调用 Stop
+func (c *Collector) SetVersionHandler(f func(version string)) {
+	c.versionHandler = f
+}
+
+// collectTotals 按 tracker 及分类的累计流量
+func (c *Collector) collectTotals(metrics chan<- prometheus.Metric, snap *snapshot) {
+	for tracker, t := range snap.trackerTotals {
+		metrics <- prometheus.MustNewConstMetric(c.trackerUploadedTotal, prometheus.CounterValue, float64(t.Uploaded), tracker)
+		metrics <- prometheus.MustNewConstMetric(c.trackerDownloadedTotal, prometheus.CounterValue, float64(t.Downloaded), tracker)
+	}
+	for category, t := range snap.categoryTotals {
+		metrics <- prometheus.MustNewConstMetric(c.categoryUploadedTotal, prometheus.CounterValue, float64(t.Uploaded), category)
+		metrics <- prometheus.MustNewConstMetric(c.categoryDownloadedTotal, prometheus.CounterValue, float64(t.Downloaded), category)
+	}
+}
+
+// countState 按状态及 tracker 计数
+func countState(state map[string]map[string]int, stateName string, trackerName string) {
+	if _, stateOk := state[stateName]; !stateOk {
+		state[stateName] = make(map[string]int)
+	}
+	state[stateName][trackerName]++
+}
+
+// torrentSeries 需要输出种子维度指标的种子 nil 表示全部
+// 关闭种子指标时为空 配置 TopTorrents 时为当前上传速度最高的 N 个
+func (c *Collector) torrentSeries(torrents []client.Torrent) map[string]bool {
+	if c.Options.DisableTorrentMetrics {
+		return map[string]bool{}
+	}
+	if c.Options.TopTorrents <= 0 || c.Options.TopTorrents >= len(torrents) {
+		return nil
+	}
+	sorted := append([]client.Torrent(nil), torrents...)
+	// 速度相同时按 hash 排序 下载器返回的顺序不固定 避免每次轮询选中不同的空闲种子
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].UploadSpeed != sorted[j].UploadSpeed {
+			return sorted[i].UploadSpeed > sorted[j].UploadSpeed
+		}
+		return sorted[i].Hash < sorted[j].Hash
+	})
+	series := make(map[string]bool, c.Options.TopTorrents)
+	for _, torrent := range sorted[:c.Options.TopTorrents] {
+		series[torrent.Hash] = true
+	}
+	return series
+}
+
+// collectTorrent 输出单个种子在一个 tracker 标签下的指标
+func (c *Collector) collectTorrent(metrics chan<- prometheus.Metric, torrent client.Torrent, trackerName string) {
+	labels := c.torrentLabels(torrent, trackerName)
+	// torrent
+	if !c.Options.DownloaderExporter {
+		metrics <- prometheus.MustNewConstMetric(
+			c.torrent,
+			prometheus.CounterValue,
+			float64(1),
+			labels...,
+		)
+		// torrent 大小
+		metrics <- prometheus.MustNewConstMetric(
+			c.torrentSizeBytes,
+			prometheus.GaugeValue,
+			float64(torrent.Size),
+			labels...,
+		)
+		c.collectTorrentTransfer(metrics, torrent, labels)
+		c.collectTorrentTimes(metrics, torrent, labels)
+	}
+	// 种子下载字节数
+	metrics <- prometheus.MustNewConstMetric(
+		c.torrentDownloadBytesTotal,
+		prometheus.CounterValue,
+		float64(torrent.Downloaded),
+		labels...,
+	)
+	// 种子上传字节数
+	metrics <- prometheus.MustNewConstMetric(
+		c.torrentUploadBytesTotal,
+		prometheus.CounterValue,
+		float64(torrent.Uploaded),
+		labels...,
+	)
+	if !c.Options.DownloaderExporter {
+		metrics <- prometheus.MustNewConstMetric(
+			c.torrentStatus,
+			prometheus.GaugeValue,
+			c.RewriteStatusInt(torrent.State),
+			labels...,
+		)
+	}
+}
+
+// torrentLabels 种子指标的标签值 与 NewCollector 中的 torrentLabelNames 对应
+func (c *Collector) torrentLabels(torrent client.Torrent, trackerName string) []string {
+	labels := []string{torrent.Hash, torrent.Name, trackerName}
+	if c.Options.DownloaderExporter {
+		return labels
+	}
+	if c.Options.CategoryLabel {
+		labels = append(labels, torrent.Category)
+	}
+	if c.Options.TagsLabel {
+		tags := append([]string(nil), torrent.Tags...)
+		sort.Strings(tags)
+		labels = append(labels, strings.Join(tags, ","))
+	}
+	return labels
+}
+
+// trackerNames 按 TrackerPolicy 获取种子的 tracker 标签值 all 策略下每个 tracker 一个
+// trackers 为下载器返回的全部 tracker 状态 未获取时按 primary 处理
+func (c *Collector) trackerNames(torrent client.Torrent, trackers []client.TrackerStatus) []string {
+	if c.Options.UseCategoryAsTracker && torrent.Category != "" {
+		return []string{torrent.Category}
+	}
+	switch c.Options.TrackerPolicy {
+	case TrackerPolicyWorking:
+		for _, t := range trackers {
+			if t.Status == client.TrackerOK {
+				return []string{c.trackerHost(t.URL)}
+			}
+		}
+	case TrackerPolicyAll:
+		names := make([]string, 0, len(trackers))
+		seen := make(map[string]bool)
+		for _, t := range trackers {
+			name := c.trackerHost(t.URL)
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+		if len(names) > 0 {
+			return names
+		}
+	}
+	return []string{c.primaryTrackerName(torrent, trackers)}
+}
+
+// primaryTrackerName 主 tracker 的标签值 累计流量始终使用主 tracker
+func (c *Collector) primaryTrackerName(torrent client.Torrent, trackers []client.TrackerStatus) string {
+	// qBittorrent 没有正常工作的 tracker 时 tracker 字段为空
+	if torrent.Tracker == "" && len(trackers) > 0 && !(c.Options.UseCategoryAsTracker && torrent.Category != "") {
+		return c.trackerHost(trackers[0].URL)
+	}
+	return c.trackerName(torrent)
+}
+
+// trackerName 获取种子的 tracker 标签值 依次应用重写列表及分类替换
+func (c *Collector) trackerName(torrent client.Torrent) string {
+	trackerName := c.trackerHost(torrent.Tracker)
+	// 判断是否用分类名称重写分类是否为空
+	if c.Options.UseCategoryAsTracker && torrent.Category != "" {
+		trackerName = torrent.Category
+	}
+	return trackerName
+}
+
+// trackerHost tracker 地址转换为域名并应用重写规则 地址为空时为 NoTrackerLabel
+func (c *Collector) trackerHost(address string) string {
+	if address == "" {
+		return NoTrackerLabel
+	}
+	trackerName, _ := c.rewriteHost(trackerAddressHost(address))
+	return trackerName
+}
+
+// trackerAddressHost 获取 tracker 地址中的域名 部分下载器只返回 tracker 域名
+func trackerAddressHost(address string) string {
+	if trackerUrl, err := url.Parse(address); err == nil && trackerUrl.Hostname() != "" {
+		return trackerUrl.Hostname()
+	}
+	return address
+}
+
+// RewriteStatusInt 统一状态转换为状态码
+func (c *Collector) RewriteStatusInt(status string) float64 {
+	switch status {
+	case client.StateUnknown:
+		return 0
+	case client.StateAllocating:
+		return 1
+	case client.StateDownloading:
+		return 2
+	case client.StateUploading:
+		return 3
+	case client.StateChecking:
+		return 4
+	case client.StateError:
+		return 5
+	case client.StateStalled:
+		return 6
+	case client.StateQueued:
+		return 7
+	case client.StatePaused:
+		return 8
+	case client.StateMoving:
+		return 9
+	default:
+		return 10
+	}
+}
+
+// RewriteStatusStr 统一状态转换为 downloader_exporter 兼容的状态名称
+func (c *Collector) RewriteStatusStr(status string) string {
+	if c.Options.Lang == "zh" {
+		switch status {
+		case client.StateUnknown:
+			return "未知"
+		case client.StateAllocating:
+			return "分配"
+		case client.StateDownloading:
+			return "下载中"
+		case client.StateUploading:
+			return "上传中"
+		case client.StateChecking:
+			return "校验"
+		case client.StateError:
+			return "错误"
+		case client.StateStalled:
+			return "等待"
+		case client.StateQueued:
+			return "排队"
+		case client.StatePaused:
+			return "暂停"
+		case client.StateMoving:
+			return "移动中"
+		default:
+			return status
+		}
+	} else {
+		switch status {
+		case client.StateUnknown:
+			return "Unknown"
+		case client.StateAllocating:
+			return "Allocating"
+		case client.StateDownloading:
+			return "Downloading"
+		case client.StateUploading:
+			return "Uploading"
+		case client.StateChecking:
+			return "Checking"
+		case client.StateError:
+			return "Errored"
+		case client.StateStalled:
+			return "Stalled"
+		case client.StateQueued:
+			return "Queued"
+		case client.StatePaused:
+			return "Paused"
+		case client.StateMoving:
+			return "Moving"
+		default:
+			return status
+		}
+	}
 }
 
 func fqNameRewrite(s1 string, s2 string, b bool) string {
@@ -0,0 +1,205 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/chenpt0809/pt-exporter/client"
+	"github.com/chenpt0809/pt-exporter/global"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// transferTotal 累计上传下载量 单位字节
+type transferTotal struct {
+	Uploaded   int64 `json:"uploaded"`
+	Downloaded int64 `json:"downloaded"`
+}
+
+// torrentTotal 最近一次轮询到种子时的上传下载量及计入的 tracker
+type torrentTotal struct {
+	transferTotal
+	Tracker string `json:"tracker,omitempty"`
+	Seen    int64  `json:"seen,omitempty"` // 最近一次轮询到的时间 unix 秒
+}
+
+// counterState 单个下载器的累计计数
+type counterState struct {
+	Torrents   map[string]torrentTotal  `json:"torrents"`   // 每个种子最近一次的上传下载量
+	Trackers   map[string]transferTotal `json:"trackers"`   // 每个 tracker 的累计量
+	Categories map[string]transferTotal `json:"categories"` // 每个分类的累计量
+}
+
+// CounterStore 按 tracker 及分类累计的上传下载量 种子删除后不会减少
+// 以下载器名称区分 path 不为空时定时保存到 JSON 文件 重启后继续累计
+type CounterStore struct {
+	path      string
+	mutex     sync.Mutex
+	saveMutex sync.Mutex               // 定时保存与退出时保存依次写入
+	dirty     bool                     // 上次保存后有更新
+	States    map[string]*counterState `json:"states"`
+}
+
+const (
+	// CounterSaveInterval 累计流量的保存间隔
+	CounterSaveInterval = time.Minute
+	// 超过该时长没有轮询到的种子不再保留上次的上传下载量
+	// 被过滤或暂时未返回的种子再次出现时只计入增量 超过后视为新种子
+	counterTorrentMaxAge = 30 * 24 * time.Hour
+)
+
+// NewCounterStore 创建累计计数 path 为空时只保存在内存中
+// 文件无法读取时返回 nil 文件损坏时重命名为 .corrupt 后重新开始累计 避免保存时覆盖
+func NewCounterStore(path string) (*CounterStore, error) {
+	s := &CounterStore{
+		path:   path,
+		States: make(map[string]*counterState),
+	}
+	if path == "" {
+		return s, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		if renameErr := os.Rename(path, path+".corrupt"); renameErr != nil {
+			return nil, fmt.Errorf("%v 且无法重命名: %w", err, renameErr)
+		}
+		return &CounterStore{path: path, States: make(map[string]*counterState)}, fmt.Errorf("%w 已重命名为 %s", err, path+".corrupt")
+	}
+	return s, nil
+}
+
+// update 根据本次轮询的种子累加增量 groups 返回种子需要计入的 tracker 及分类
+// 新种子计入全部上传下载量 上传下载量减少时视为重新添加 同样计入全部
+// tracker 为 none 时沿用该种子之前计入的 tracker 避免 tracker 暂时无法连接时流量计入 none
+func (s *CounterStore) update(name string, torrents []client.Torrent, groups func(client.Torrent) (tracker string, category string)) (map[string]transferTotal, map[string]transferTotal) {
+	return s.updateAt(time.Now(), name, torrents, groups)
+}
+
+func (s *CounterStore) updateAt(now time.Time, name string, torrents []client.Torrent, groups func(client.Torrent) (tracker string, category string)) (map[string]transferTotal, map[string]transferTotal) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.dirty = true
+	state, ok := s.States[name]
+	if !ok || state == nil {
+		state = &counterState{}
+		s.States[name] = state
+	}
+	if state.Trackers == nil {
+		state.Trackers = make(map[string]transferTotal)
+	}
+	if state.Categories == nil {
+		state.Categories = make(map[string]transferTotal)
+	}
+	if state.Torrents == nil {
+		state.Torrents = make(map[string]torrentTotal)
+	}
+	seen := now.Unix()
+	for _, torrent := range torrents {
+		total := transferTotal{Uploaded: torrent.Uploaded, Downloaded: torrent.Downloaded}
+		delta := total
+		tracker, category := groups(torrent)
+		prev, ok := state.Torrents[torrent.Hash]
+		if ok {
+			if total.Uploaded >= prev.Uploaded {
+				delta.Uploaded = total.Uploaded - prev.Uploaded
+			}
+			if total.Downloaded >= prev.Downloaded {
+				delta.Downloaded = total.Downloaded - prev.Downloaded
+			}
+			if tracker == NoTrackerLabel && prev.Tracker != "" {
+				tracker = prev.Tracker
+			}
+		}
+		state.Torrents[torrent.Hash] = torrentTotal{transferTotal: total, Tracker: tracker, Seen: seen}
+		state.Trackers[tracker] = state.Trackers[tracker].add(delta)
+		state.Categories[category] = state.Categories[category].add(delta)
+	}
+	// 本次没有出现的种子保留上次的量 超过 counterTorrentMaxAge 后移除 已累计的量保留
+	for hash, t := range state.Torrents {
+		// 旧版本保存的记录没有时间
+		if t.Seen == 0 {
+			t.Seen = seen
+			state.Torrents[hash] = t
+		}
+		if now.Sub(time.Unix(t.Seen, 0)) > counterTorrentMaxAge {
+			delete(state.Torrents, hash)
+		}
+	}
+	return copyTotals(state.Trackers), copyTotals(state.Categories)
+}
+
+// Run 每隔 interval 保存一次 没有更新时不写入
+func (s *CounterStore) Run(interval time.Duration) {
+	if s.path == "" {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := s.Save(); err != nil {
+			global.Logger.Error("保存累计流量失败\t"+s.path, zap.Error(err))
+		}
+	}
+}
+
+// Save 有更新时保存到文件 先写入临时文件再重命名 避免写入中断时损坏
+func (s *CounterStore) Save() (err error) {
+	if s.path == "" {
+		return nil
+	}
+	s.saveMutex.Lock()
+	defer s.saveMutex.Unlock()
+	s.mutex.Lock()
+	if !s.dirty {
+		s.mutex.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(s)
+	s.dirty = false
+	s.mutex.Unlock()
+	// 保存失败时下次重试
+	defer func() {
+		if err != nil {
+			s.mutex.Lock()
+			s.dirty = true
+			s.mutex.Unlock()
+		}
+	}()
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+func (t transferTotal) add(delta transferTotal) transferTotal {
+	return transferTotal{Uploaded: t.Uploaded + delta.Uploaded, Downloaded: t.Downloaded + delta.Downloaded}
+}
+
+func copyTotals(totals map[string]transferTotal) map[string]transferTotal {
+	result := make(map[string]transferTotal, len(totals))
+	for k, v := range totals {
+		result[k] = v
+	}
+	return result
+}
@@ -0,0 +1,166 @@
+package collector
+
+import (
+	"github.com/chenpt0809/pt-exporter/client"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// counterPoll 一次轮询中的种子 tracker 为 groups 返回的 tracker
+type counterPoll struct {
+	after    time.Duration // 距离第一次轮询的时间
+	torrents []counterTorrent
+}
+
+type counterTorrent struct {
+	hash     string
+	tracker  string
+	uploaded int64
+}
+
+func TestCounterStoreUpdate(t *testing.T) {
+	tests := []struct {
+		name  string
+		polls []counterPoll
+		want  map[string]int64 // 每个 tracker 的累计上传
+	}{
+		{
+			name: "新种子计入全部",
+			polls: []counterPoll{
+				{torrents: []counterTorrent{{"a", "site", 100}}},
+				{torrents: []counterTorrent{{"a", "site", 150}}},
+			},
+			want: map[string]int64{"site": 150},
+		},
+		{
+			name: "暂时消失后再次出现只计入增量",
+			polls: []counterPoll{
+				{torrents: []counterTorrent{{"a", "site", 100}, {"b", "site", 10}}},
+				{after: time.Minute, torrents: []counterTorrent{{"b", "site", 10}}},
+				{after: 2 * time.Minute, torrents: []counterTorrent{{"a", "site", 120}, {"b", "site", 10}}},
+			},
+			want: map[string]int64{"site": 130},
+		},
+		{
+			name: "超过保留时长后视为新种子",
+			polls: []counterPoll{
+				{torrents: []counterTorrent{{"a", "site", 100}}},
+				{after: time.Minute, torrents: []counterTorrent{}},
+				{after: counterTorrentMaxAge + 2*time.Minute, torrents: []counterTorrent{}},
+				{after: counterTorrentMaxAge + 3*time.Minute, torrents: []counterTorrent{{"a", "site", 120}}},
+			},
+			want: map[string]int64{"site": 220},
+		},
+		{
+			name: "上传量减少视为重新添加",
+			polls: []counterPoll{
+				{torrents: []counterTorrent{{"a", "site", 100}}},
+				{after: time.Minute, torrents: []counterTorrent{{"a", "site", 30}}},
+			},
+			want: map[string]int64{"site": 130},
+		},
+		{
+			name: "tracker 为 none 时沿用之前的 tracker",
+			polls: []counterPoll{
+				{torrents: []counterTorrent{{"a", "site", 100}}},
+				{after: time.Minute, torrents: []counterTorrent{{"a", NoTrackerLabel, 150}}},
+				{after: 2 * time.Minute, torrents: []counterTorrent{{"a", NoTrackerLabel, 170}}},
+				{after: 3 * time.Minute, torrents: []counterTorrent{{"a", "site", 200}}},
+			},
+			want: map[string]int64{"site": 200},
+		},
+		{
+			name: "从未有 tracker 的种子计入 none",
+			polls: []counterPoll{
+				{torrents: []counterTorrent{{"a", NoTrackerLabel, 100}}},
+				{after: time.Minute, torrents: []counterTorrent{{"a", NoTrackerLabel, 110}}},
+			},
+			want: map[string]int64{NoTrackerLabel: 110},
+		},
+		{
+			name: "tracker 变化后计入新的 tracker",
+			polls: []counterPoll{
+				{torrents: []counterTorrent{{"a", "old", 100}}},
+				{after: time.Minute, torrents: []counterTorrent{{"a", "new", 150}}},
+			},
+			want: map[string]int64{"old": 100, "new": 50},
+		},
+	}
+	start := time.Unix(1700000000, 0)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewCounterStore("")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var trackers map[string]transferTotal
+			for _, poll := range tt.polls {
+				torrents := make([]client.Torrent, 0, len(poll.torrents))
+				groups := make(map[string]string)
+				for _, torrent := range poll.torrents {
+					torrents = append(torrents, client.Torrent{Hash: torrent.hash, Uploaded: torrent.uploaded})
+					groups[torrent.hash] = torrent.tracker
+				}
+				trackers, _ = s.updateAt(start.Add(poll.after), "qb", torrents, func(torrent client.Torrent) (string, string) {
+					return groups[torrent.Hash], NoGroupLabel
+				})
+			}
+			got := make(map[string]int64, len(trackers))
+			for tracker, total := range trackers {
+				got[tracker] = total.Uploaded
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCounterStoreFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pt-exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.json")
+
+	s, err := NewCounterStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.update("qb", []client.Torrent{{Hash: "a", Uploaded: 100}}, func(client.Torrent) (string, string) {
+		return "site", NoGroupLabel
+	})
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := NewCounterStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trackers, _ := loaded.update("qb", []client.Torrent{{Hash: "a", Uploaded: 120}}, func(client.Torrent) (string, string) {
+		return "site", NoGroupLabel
+	})
+	if trackers["site"].Uploaded != 120 {
+		t.Errorf("重启后应继续累计 got %d", trackers["site"].Uploaded)
+	}
+
+	// 文件损坏时重命名 避免保存时覆盖
+	if err := ioutil.WriteFile(path, []byte("{broken"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err = NewCounterStore(path)
+	if err == nil || s == nil {
+		t.Fatalf("文件损坏时应返回空的累计及错误 got %v %v", s, err)
+	}
+	if data, err := ioutil.ReadFile(path + ".corrupt"); err != nil || string(data) != "{broken" {
+		t.Errorf("损坏的文件未重命名 %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("原文件应已移走 %v", err)
+	}
+}
@@ -0,0 +1,189 @@
+package collector
+
+import (
+	"errors"
+	"github.com/chenpt0809/pt-exporter/client"
+	"github.com/chenpt0809/pt-exporter/global"
+	"github.com/chenpt0809/pt-exporter/utils"
+	"go.uber.org/zap"
+	"regexp"
+	"strings"
+)
+
+// TorrentFilter 种子过滤规则 同一规则中配置的条件需要全部满足
+// tracker 匹配主 tracker 开启 tracker-health 或 tracker-policy 为 working、all 时匹配全部 tracker
+type TorrentFilter struct {
+	Tracker  string `mapstructure:"tracker"`   // tracker 域名或其子域名 也可以是重写后的名称 没有 tracker 的种子为 none
+	Category string `mapstructure:"category"`  // 分类 未分类为 none
+	Tag      string `mapstructure:"tag"`       // 任一标签相同
+	SavePath string `mapstructure:"save-path"` // 保存路径为该目录或其子目录
+	State    string `mapstructure:"state"`     // 统一状态 如 downloading、uploading
+	Name     string `mapstructure:"name"`      // 种子名称正则
+	MinSize  string `mapstructure:"min-size"`  // 最小大小 如 500MB、1GB
+}
+
+// TorrentFilters 种子过滤 include 为空时包含全部种子 同时匹配 include 与 exclude 时排除
+// 过滤在轮询时进行 被过滤的种子不计入任何指标
+type TorrentFilters struct {
+	Include []TorrentFilter `mapstructure:"include"`
+	Exclude []TorrentFilter `mapstructure:"exclude"`
+}
+
+// compiledTorrentFilter 预编译正则及大小后的规则
+type compiledTorrentFilter struct {
+	TorrentFilter
+	name    *regexp.Regexp
+	minSize int64
+}
+
+// Validate 校验全部规则
+func (f TorrentFilters) Validate() error {
+	for _, rule := range append(append([]TorrentFilter{}, f.Include...), f.Exclude...) {
+		if _, err := rule.compile(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r TorrentFilter) compile() (compiledTorrentFilter, error) {
+	rule := compiledTorrentFilter{TorrentFilter: r}
+	if r == (TorrentFilter{}) {
+		return rule, errors.New("过滤规则没有配置任何条件")
+	}
+	if r.Name != "" {
+		re, err := regexp.Compile(r.Name)
+		if err != nil {
+			return rule, err
+		}
+		rule.name = re
+	}
+	if r.MinSize != "" {
+		size, err := utils.SizeToInt(r.MinSize)
+		if err != nil {
+			return rule, err
+		}
+		rule.minSize = size
+	}
+	return rule, nil
+}
+
+// compileTorrentFilters 编译规则 无效的规则记录日志后跳过 需要先通过 Validate 校验
+func compileTorrentFilters(rules []TorrentFilter) []compiledTorrentFilter {
+	compiled := make([]compiledTorrentFilter, 0, len(rules))
+	for _, r := range rules {
+		rule, err := r.compile()
+		if err != nil {
+			global.Logger.Error("跳过无效的种子过滤规则", zap.Any("rule", r), zap.Error(err))
+			continue
+		}
+		compiled = append(compiled, rule)
+	}
+	return compiled
+}
+
+// matchFilter 种子满足规则中的全部条件 trackers 为种子的全部 tracker 地址
+func (c *Collector) matchFilter(r compiledTorrentFilter, torrent client.Torrent, trackers []string) bool {
+	if r.Tracker != "" && !c.matchTracker(r.Tracker, trackers) {
+		return false
+	}
+	if r.Category != "" {
+		category := torrent.Category
+		if category == "" {
+			category = NoGroupLabel
+		}
+		if category != r.Category {
+			return false
+		}
+	}
+	if r.Tag != "" && !containsString(torrent.Tags, r.Tag) {
+		return false
+	}
+	if r.SavePath != "" && !hasPathPrefix(torrent.SavePath, r.SavePath) {
+		return false
+	}
+	if r.State != "" && torrent.State != r.State {
+		return false
+	}
+	if r.name != nil && !r.name.MatchString(torrent.Name) {
+		return false
+	}
+	if r.MinSize != "" && torrent.Size < r.minSize {
+		return false
+	}
+	return true
+}
+
+// matchTracker 任一 tracker 的域名为 pattern 或其子域名 或重写后的名称与 pattern 相同
+func (c *Collector) matchTracker(pattern string, trackers []string) bool {
+	if len(trackers) == 0 {
+		return pattern == NoTrackerLabel
+	}
+	for _, address := range trackers {
+		host := trackerAddressHost(address)
+		if host != "" && hasDomainSuffix(host, pattern) {
+			return true
+		}
+		if c.trackerHost(address) == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// filterTorrents 按 include、exclude 规则过滤种子 没有配置规则时原样返回
+func (c *Collector) filterTorrents(snap *snapshot) []client.Torrent {
+	if len(c.include) == 0 && len(c.exclude) == 0 {
+		return snap.torrents
+	}
+	torrents := make([]client.Torrent, 0, len(snap.torrents))
+	for _, torrent := range snap.torrents {
+		trackers := make([]string, 0, 1)
+		if torrent.Tracker != "" {
+			trackers = append(trackers, torrent.Tracker)
+		}
+		for _, t := range snap.trackers[torrent.Hash] {
+			trackers = append(trackers, t.URL)
+		}
+		if c.keepTorrent(torrent, trackers) {
+			torrents = append(torrents, torrent)
+		}
+	}
+	return torrents
+}
+
+func (c *Collector) keepTorrent(torrent client.Torrent, trackers []string) bool {
+	for _, r := range c.exclude {
+		if c.matchFilter(r, torrent, trackers) {
+			return false
+		}
+	}
+	if len(c.include) == 0 {
+		return true
+	}
+	for _, r := range c.include {
+		if c.matchFilter(r, torrent, trackers) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// hasPathPrefix path 为 dir 或其子目录 同时支持 / 与 \ 分隔的路径
+func hasPathPrefix(path string, dir string) bool {
+	path = strings.TrimRight(strings.ReplaceAll(path, "\\", "/"), "/")
+	dir = strings.TrimRight(strings.ReplaceAll(dir, "\\", "/"), "/")
+	if dir == "" {
+		return strings.HasPrefix(path, "/")
+	}
+	return path == dir || strings.HasPrefix(path, dir+"/")
+}
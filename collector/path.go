@@ -0,0 +1,91 @@
+package collector
+
+import (
+	"fmt"
+	"github.com/chenpt0809/pt-exporter/client"
+	"github.com/chenpt0809/pt-exporter/global"
+	"github.com/chenpt0809/pt-exporter/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"strings"
+)
+
+// pathKey 种子保存路径的分组 位于 FreeSpacePaths 中的目录下时使用最长的目录 否则使用保存路径本身
+func (c *Collector) pathKey(savePath string) string {
+	key := ""
+	for _, p := range c.Options.FreeSpacePaths {
+		if hasPathPrefix(savePath, p) && len(cleanPath(p)) > len(key) {
+			key = cleanPath(p)
+		}
+	}
+	if key != "" {
+		return key
+	}
+	return cleanPath(savePath)
+}
+
+// cleanPath 去掉末尾的分隔符 避免同一目录出现两个标签值
+func cleanPath(path string) string {
+	if trimmed := strings.TrimRight(path, "/\\"); trimmed != "" {
+		return trimmed
+	}
+	return path
+}
+
+// fetchPathFreeSpace 每个路径的剩余空间 FreeSpacePaths 在本机 statfs 其余保存路径通过下载器查询
+// 获取失败的路径不输出
+func (c *Collector) fetchPathFreeSpace(torrents []client.Torrent) map[string]int64 {
+	free := make(map[string]int64)
+	for _, p := range c.Options.FreeSpacePaths {
+		size, err := utils.DiskFree(p)
+		if err != nil {
+			global.Logger.Debug(fmt.Sprintf("%s 获取目录剩余空间失败 %s %v", c.clientName, p, err))
+			continue
+		}
+		free[cleanPath(p)] = size
+	}
+	pf, ok := c.downloader.(client.PathFreeSpacer)
+	if !ok {
+		return free
+	}
+	queried := make(map[string]bool)
+	for _, torrent := range torrents {
+		key := c.pathKey(torrent.SavePath)
+		if key == "" || queried[key] || c.isFreeSpacePath(key) {
+			continue
+		}
+		queried[key] = true
+		size, err := pf.PathFreeSpace(key)
+		if err != nil {
+			global.Logger.Debug(fmt.Sprintf("%s 获取目录剩余空间失败 %s %v", c.clientName, key, err))
+			continue
+		}
+		free[key] = size
+	}
+	return free
+}
+
+func (c *Collector) isFreeSpacePath(path string) bool {
+	for _, p := range c.Options.FreeSpacePaths {
+		if cleanPath(p) == path {
+			return true
+		}
+	}
+	return false
+}
+
+// collectPaths 每个路径的剩余空间及种子已完成的数据量
+func (c *Collector) collectPaths(metrics chan<- prometheus.Metric, snap *snapshot) {
+	stored := make(map[string]int64)
+	for _, torrent := range snap.torrents {
+		if torrent.SavePath == "" {
+			continue
+		}
+		stored[c.pathKey(torrent.SavePath)] += int64(float64(torrent.Size) * torrent.Progress)
+	}
+	for path, size := range stored {
+		metrics <- prometheus.MustNewConstMetric(c.pathTorrentBytes, prometheus.GaugeValue, float64(size), path)
+	}
+	for path, size := range snap.pathFreeSpace {
+		metrics <- prometheus.MustNewConstMetric(c.pathFreeBytes, prometheus.GaugeValue, float64(size), path)
+	}
+}
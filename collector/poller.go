@@ -0,0 +1,205 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"github.com/chenpt0809/pt-exporter/client"
+	"github.com/chenpt0809/pt-exporter/global"
+	"time"
+)
+
+const (
+	// 默认轮询间隔
+	defaultPollInterval = 15 * time.Second
+	// Stop 等待当前轮询结束的最长时间
+	stopTimeout = 10 * time.Second
+)
+
+// snapshot 一次成功轮询得到的下载器数据
+type snapshot struct {
+	time         time.Time
+	status       client.Status
+	torrents     []client.Torrent
+	freeSpace    int64
+	hasFreeSpace bool
+	// 每个保存路径的剩余空间
+	pathFreeSpace map[string]int64
+	trackers      map[string][]client.TrackerStatus
+	hasTrackers   bool
+	session       client.Session
+	hasSession    bool
+	version       *client.VersionInfo
+	unmatched     []string // 没有匹配重写规则的 tracker 域名
+	// 按 tracker 及分类的累计上传下载量
+	trackerTotals  map[string]transferTotal
+	categoryTotals map[string]transferTotal
+}
+
+// Start 启动后台轮询 采集时直接读取最近一次轮询结果
+func (c *Collector) Start() {
+	c.stop = make(chan struct{})
+	c.done = make(chan struct{})
+	go c.pollLoop(c.stop, c.done)
+}
+
+// Stop 停止后台轮询并等待当前轮询结束 最多等待 stopTimeout 避免下载器无响应时阻塞热加载
+func (c *Collector) Stop() {
+	if c.stop == nil {
+		return
+	}
+	close(c.stop)
+	select {
+	case <-c.done:
+	case <-time.After(stopTimeout):
+		global.Logger.Warn(c.clientName + " 等待轮询结束超时 轮询结束后自动退出")
+	}
+	c.stop = nil
+}
+
+func (c *Collector) pollLoop(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(c.pollInterval())
+	defer ticker.Stop()
+	c.poll()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			c.poll()
+		}
+	}
+}
+
+// poll 从下载器获取一次数据 成功时替换缓存 失败时保留上一次的缓存
+func (c *Collector) poll() {
+	stime := time.Now()
+	snap, err := c.fetch()
+	c.self.pollDuration.Observe(time.Since(stime).Seconds())
+	if err != nil {
+		global.Logger.Debug(fmt.Sprintf("%s 轮询失败 %v", c.clientName, err))
+		// 下载器可能重启或升级 恢复后重新获取版本
+		c.version = nil
+		return
+	}
+	if c.version == nil {
+		version, err := c.downloader.Version()
+		if err == nil {
+			c.version = &version
+			if c.versionHandler != nil {
+				c.versionHandler(version.Version)
+			}
+		} else {
+			global.Logger.Debug(fmt.Sprintf("%s 获取版本失败 %v", c.clientName, err))
+		}
+	}
+	snap.version = c.version
+	c.self.lastSuccess.SetToCurrentTime()
+	global.Logger.Debug(fmt.Sprintf("%s 获取信息成功 时间:%.3f秒", c.clientName, time.Since(stime).Seconds()))
+	if !c.Options.DownloaderExporter {
+		c.updateCounters(snap)
+	}
+	c.mutex.Lock()
+	c.snapshot = snap
+	c.mutex.Unlock()
+}
+
+// updateCounters 累加本次轮询的增量 由 CounterStore 定时保存
+func (c *Collector) updateCounters(snap *snapshot) {
+	snap.trackerTotals, snap.categoryTotals = c.counters.update(c.clientName, snap.torrents, func(torrent client.Torrent) (string, string) {
+		category := torrent.Category
+		if category == "" {
+			category = NoGroupLabel
+		}
+		return c.primaryTrackerName(torrent, snap.trackers[torrent.Hash]), category
+	})
+}
+
+func (c *Collector) fetch() (*snapshot, error) {
+	// 一次请求获取全部数据的下载器先刷新
+	if r, ok := c.downloader.(client.Refresher); ok {
+		if err := r.Refresh(); err != nil {
+			return nil, fmt.Errorf("刷新数据失败 %w", err)
+		}
+	}
+	status, err := c.downloader.Status()
+	if err != nil {
+		return nil, fmt.Errorf("获取状态信息失败 %w", err)
+	}
+	torrents, err := c.downloader.Torrents()
+	if err != nil {
+		return nil, fmt.Errorf("获取种子信息失败 %w", err)
+	}
+	snap := &snapshot{
+		time:     time.Now(),
+		status:   status,
+		torrents: c.uniqueTorrents(torrents),
+	}
+	freeSpace, err := c.downloader.FreeSpace()
+	if err == nil {
+		snap.freeSpace = freeSpace
+		snap.hasFreeSpace = true
+	} else if !errors.Is(err, client.ErrNotSupported) {
+		global.Logger.Debug(fmt.Sprintf("%s 获取剩余空间失败 %v", c.clientName, err))
+	}
+	if r, ok := c.downloader.(client.SessionReporter); ok {
+		session, err := r.Session()
+		if err == nil {
+			snap.session = session
+			snap.hasSession = true
+		} else {
+			global.Logger.Debug(fmt.Sprintf("%s 获取会话状态失败 %v", c.clientName, err))
+		}
+	}
+	// tracker 汇报状态 失败时不影响其他数据
+	if r, ok := c.downloader.(client.TrackerReporter); ok && c.needTrackers() {
+		trackers, err := r.Trackers()
+		if err == nil {
+			snap.trackers = trackers
+			snap.hasTrackers = true
+		} else {
+			global.Logger.Debug(fmt.Sprintf("%s 获取 tracker 状态失败 %v", c.clientName, err))
+		}
+	}
+	snap.torrents = c.filterTorrents(snap)
+	snap.unmatched = c.unmatchedHosts(snap)
+	if !c.Options.DownloaderExporter {
+		snap.pathFreeSpace = c.fetchPathFreeSpace(snap.torrents)
+	}
+	return snap, nil
+}
+
+// uniqueTorrents 去除 hash 重复的种子 只保留第一个 重复的标签会导致整个采集失败
+func (c *Collector) uniqueTorrents(torrents []client.Torrent) []client.Torrent {
+	seen := make(map[string]struct{}, len(torrents))
+	result := torrents[:0]
+	for _, torrent := range torrents {
+		if _, ok := seen[torrent.Hash]; ok {
+			global.Logger.Debug(fmt.Sprintf("%s 忽略重复的种子 %s", c.clientName, torrent.Hash))
+			continue
+		}
+		seen[torrent.Hash] = struct{}{}
+		result = append(result, torrent)
+	}
+	return result
+}
+
+// needTrackers 开启 tracker 健康检查或 tracker 标签策略需要全部 tracker 时获取
+func (c *Collector) needTrackers() bool {
+	return c.Options.TrackerHealth || c.Options.TrackerPolicy == TrackerPolicyWorking || c.Options.TrackerPolicy == TrackerPolicyAll
+}
+
+func (c *Collector) pollInterval() time.Duration {
+	if c.Options.PollInterval <= 0 {
+		return defaultPollInterval
+	}
+	return c.Options.PollInterval
+}
+
+// maxAge 缓存超过该时长视为下载器不可用 未配置时为三个轮询间隔
+func (c *Collector) maxAge() time.Duration {
+	if c.Options.MaxAge <= 0 {
+		return 3 * c.pollInterval()
+	}
+	return c.Options.MaxAge
+}
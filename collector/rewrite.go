@@ -0,0 +1,173 @@
+package collector
+
+import (
+	"errors"
+	"github.com/chenpt0809/pt-exporter/global"
+	"go.uber.org/zap"
+	"golang.org/x/net/publicsuffix"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// tracker 重写规则类型
+const (
+	RewriteExact  = "exact"  // 域名完全一致
+	RewriteSuffix = "suffix" // 域名或其子域名
+	RewriteRegex  = "regex"  // 正则匹配 name 中可以使用 $1 引用分组
+	RewriteETLD1  = "etld1"  // 合并为可注册域名 如 tracker1.site.com 合并为 site.com
+)
+
+// RewriteRule tracker 重写规则 按顺序匹配 第一个匹配的规则生效
+type RewriteRule struct {
+	Type    string `mapstructure:"type"`
+	Pattern string `mapstructure:"pattern"` // etld1 为空时匹配全部域名 否则按 suffix 匹配
+	Name    string `mapstructure:"name"`    // 重写后的名称 exact、suffix 必须配置 regex 为空时使用原域名 etld1 为空时使用可注册域名
+}
+
+// compiledRewriteRule 预编译正则后的规则
+type compiledRewriteRule struct {
+	RewriteRule
+	re *regexp.Regexp
+}
+
+// Validate 校验规则类型及正则
+func (r RewriteRule) Validate() error {
+	_, err := r.compile()
+	return err
+}
+
+func (r RewriteRule) compile() (compiledRewriteRule, error) {
+	rule := compiledRewriteRule{RewriteRule: r}
+	switch r.Type {
+	case RewriteExact, RewriteSuffix:
+		if r.Pattern == "" {
+			return rule, errors.New(r.Type + " 规则未配置 pattern")
+		}
+		if r.Name == "" {
+			return rule, errors.New(r.Type + " 规则未配置 name")
+		}
+	case RewriteRegex:
+		if r.Pattern == "" {
+			return rule, errors.New("regex 规则未配置 pattern")
+		}
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return rule, err
+		}
+		rule.re = re
+	case RewriteETLD1:
+	default:
+		return rule, errors.New("不支持的重写规则类型 " + r.Type + " 仅支持 exact、suffix、regex、etld1")
+	}
+	return rule, nil
+}
+
+// compileRewriteRules 编译全部规则 无效的规则记录日志后跳过 需要先通过 Validate 校验
+func compileRewriteRules(rules []RewriteRule) []compiledRewriteRule {
+	compiled := make([]compiledRewriteRule, 0, len(rules))
+	for _, r := range rules {
+		rule, err := r.compile()
+		if err != nil {
+			global.Logger.Error("跳过无效的 tracker 重写规则 "+r.Pattern, zap.Error(err))
+			continue
+		}
+		compiled = append(compiled, rule)
+	}
+	return compiled
+}
+
+// match 匹配成功时返回重写后的名称
+func (r compiledRewriteRule) match(host string) (string, bool) {
+	switch r.Type {
+	case RewriteExact:
+		if host == r.Pattern {
+			return r.Name, true
+		}
+	case RewriteSuffix:
+		if hasDomainSuffix(host, r.Pattern) {
+			return r.Name, true
+		}
+	case RewriteRegex:
+		m := r.re.FindStringSubmatchIndex(host)
+		if m == nil {
+			return "", false
+		}
+		// 未配置 name 或引用的分组为空时使用原域名
+		if name := string(r.re.ExpandString(nil, r.Name, host, m)); name != "" {
+			return name, true
+		}
+		return host, true
+	case RewriteETLD1:
+		if r.Pattern != "" && !hasDomainSuffix(host, r.Pattern) {
+			return "", false
+		}
+		// IP 地址没有可注册域名
+		if net.ParseIP(host) != nil {
+			return "", false
+		}
+		domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+		if err != nil {
+			return "", false
+		}
+		if r.Name != "" {
+			return r.Name, true
+		}
+		return domain, true
+	}
+	return "", false
+}
+
+// hasDomainSuffix host 为 suffix 本身或其子域名
+func hasDomainSuffix(host string, suffix string) bool {
+	suffix = strings.TrimPrefix(suffix, ".")
+	return host == suffix || strings.HasSuffix(host, "."+suffix)
+}
+
+// rewriteHost 依次应用 RewriteTracker 及 RewriteRules 返回名称及是否有规则匹配
+func (c *Collector) rewriteHost(host string) (string, bool) {
+	if name, ok := c.Options.RewriteTracker[host]; ok {
+		return name, true
+	}
+	for _, r := range c.rewriteRules {
+		if name, ok := r.match(host); ok {
+			return name, true
+		}
+	}
+	return host, false
+}
+
+// unmatchedHosts 快照中没有匹配任何重写规则的 tracker 域名
+func (c *Collector) unmatchedHosts(snap *snapshot) []string {
+	seen := make(map[string]bool)
+	hosts := make([]string, 0)
+	check := func(address string) {
+		host := trackerAddressHost(address)
+		if host == "" || seen[host] {
+			return
+		}
+		seen[host] = true
+		if _, ok := c.rewriteHost(host); !ok {
+			hosts = append(hosts, host)
+		}
+	}
+	for _, torrent := range snap.torrents {
+		check(torrent.Tracker)
+		for _, t := range snap.trackers[torrent.Hash] {
+			check(t.URL)
+		}
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// UnmatchedTrackers 最近一次轮询中没有匹配任何重写规则的 tracker 域名
+func (c *Collector) UnmatchedTrackers() []string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if c.snapshot == nil {
+		return []string{}
+	}
+	return c.snapshot.unmatched
+}
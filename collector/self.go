@@ -0,0 +1,102 @@
+package collector
+
+import (
+	"github.com/chenpt0809/pt-exporter/client"
+	"github.com/prometheus/client_golang/prometheus"
+	"time"
+)
+
+// selfMetrics exporter 自身指标 用于区分是 exporter 还是下载器变慢
+// 实现 client.Observer 由下载器在每次请求后调用
+type selfMetrics struct {
+	pollDuration    prometheus.Histogram
+	lastSuccess     prometheus.Gauge
+	requestDuration *prometheus.HistogramVec
+	requestErrors   *prometheus.CounterVec
+	loginAttempts   prometheus.Counter
+	loginSuccess    prometheus.Counter
+}
+
+func newSelfMetrics(namespace string, constLabels prometheus.Labels) *selfMetrics {
+	return &selfMetrics{
+		// 每次轮询耗时 包含全部接口请求
+		pollDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Subsystem:   "exporter",
+			Name:        "poll_duration_seconds",
+			Help:        "每次轮询下载器的耗时",
+			Buckets:     prometheus.DefBuckets,
+			ConstLabels: constLabels,
+		}),
+		lastSuccess: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   "exporter",
+			Name:        "last_success_timestamp_seconds",
+			Help:        "最后一次轮询成功的时间 unix 时间戳",
+			ConstLabels: constLabels,
+		}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Subsystem:   "exporter",
+			Name:        "api_request_duration_seconds",
+			Help:        "每个接口的请求耗时 endpoint 为接口路径或 RPC 方法名",
+			Buckets:     prometheus.DefBuckets,
+			ConstLabels: constLabels,
+		}, []string{"endpoint"}),
+		requestErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   "exporter",
+			Name:        "api_errors_total",
+			Help:        "接口请求错误数 kind 为 network、http_status、decode、auth、other",
+			ConstLabels: constLabels,
+		}, []string{"endpoint", "kind"}),
+		loginAttempts: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   "exporter",
+			Name:        "login_attempts_total",
+			Help:        "登录次数",
+			ConstLabels: constLabels,
+		}),
+		loginSuccess: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   "exporter",
+			Name:        "login_success_total",
+			Help:        "登录成功次数",
+			ConstLabels: constLabels,
+		}),
+	}
+}
+
+// ObserveRequest 记录接口请求耗时及错误
+func (m *selfMetrics) ObserveRequest(endpoint string, duration time.Duration, err error) {
+	m.requestDuration.WithLabelValues(endpoint).Observe(duration.Seconds())
+	if err != nil {
+		m.requestErrors.WithLabelValues(endpoint, client.ErrorKind(err)).Inc()
+	}
+}
+
+// ObserveLogin 记录登录结果
+func (m *selfMetrics) ObserveLogin(err error) {
+	m.loginAttempts.Inc()
+	if err == nil {
+		m.loginSuccess.Inc()
+	}
+}
+
+func (m *selfMetrics) describe(descs chan<- *prometheus.Desc) {
+	m.pollDuration.Describe(descs)
+	m.lastSuccess.Describe(descs)
+	m.requestDuration.Describe(descs)
+	m.requestErrors.Describe(descs)
+	m.loginAttempts.Describe(descs)
+	m.loginSuccess.Describe(descs)
+}
+
+func (m *selfMetrics) collect(metrics chan<- prometheus.Metric) {
+	m.pollDuration.Collect(metrics)
+	m.lastSuccess.Collect(metrics)
+	m.requestDuration.Collect(metrics)
+	m.requestErrors.Collect(metrics)
+	m.loginAttempts.Collect(metrics)
+	m.loginSuccess.Collect(metrics)
+}
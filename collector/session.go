@@ -0,0 +1,117 @@
+package collector
+
+import (
+	"github.com/chenpt0809/pt-exporter/client"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// sessionDescs 下载器会话内部状态 实现 client.SessionReporter 的下载器输出
+type sessionDescs struct {
+	dhtNodes           *prometheus.Desc
+	peerConnections    *prometheus.Desc
+	queuedIOJobs       *prometheus.Desc
+	queuedIOBytes      *prometheus.Desc
+	averageTimeQueue   *prometheus.Desc
+	readCacheHits      *prometheus.Desc
+	readCacheOverload  *prometheus.Desc
+	writeCacheOverload *prometheus.Desc
+	buffersSize        *prometheus.Desc
+	wastedSession      *prometheus.Desc
+	globalRatio        *prometheus.Desc
+	connectionStatus   *prometheus.Desc
+	altSpeedEnabled    *prometheus.Desc
+	downloadRateLimit  *prometheus.Desc
+	uploadRateLimit    *prometheus.Desc
+}
+
+// connectionStatuses 连接状态 当前状态为 1 其余为 0 便于告警
+var connectionStatuses = []string{client.ConnectionConnected, client.ConnectionFirewalled, client.ConnectionDisconnected}
+
+func newSessionDescs(namespace string, constLabels prometheus.Labels) sessionDescs {
+	newDesc := func(name string, help string) *prometheus.Desc {
+		return prometheus.NewDesc(namespace+"_"+name, help, nil, constLabels)
+	}
+	return sessionDescs{
+		dhtNodes:           newDesc("dht_nodes", "DHT 节点数"),
+		peerConnections:    newDesc("peer_connections", "全部 peer 连接数"),
+		queuedIOJobs:       newDesc("queued_io_jobs", "排队的磁盘 IO 任务数"),
+		queuedIOBytes:      newDesc("queued_io_bytes", "排队等待写入磁盘的数据 单位字节"),
+		averageTimeQueue:   newDesc("io_queue_average_seconds", "磁盘 IO 任务平均排队时间 单位秒"),
+		readCacheHits:      newDesc("read_cache_hits_ratio", "读缓存命中率 0-1"),
+		readCacheOverload:  newDesc("read_cache_overload_ratio", "读缓存过载 0-1"),
+		writeCacheOverload: newDesc("write_cache_overload_ratio", "写缓存过载 0-1"),
+		buffersSize:        newDesc("buffers_size_bytes", "缓冲区大小 单位字节"),
+		wastedSession:      newDesc("wasted_session_bytes", "本次会话浪费的流量 单位字节"),
+		globalRatio:        newDesc("global_ratio", "全局分享率"),
+		connectionStatus: prometheus.NewDesc(
+			namespace+"_connection_status",
+			"连接状态 当前状态为 1",
+			[]string{"status"},
+			constLabels,
+		),
+		altSpeedEnabled:   newDesc("alt_speed_enabled", "是否处于备用速度模式"),
+		downloadRateLimit: newDesc("download_rate_limit_bytes", "当前生效的全局下载限速 单位字节每秒 0 为不限速"),
+		uploadRateLimit:   newDesc("upload_rate_limit_bytes", "当前生效的全局上传限速 单位字节每秒 0 为不限速"),
+	}
+}
+
+func (d sessionDescs) describe(descs chan<- *prometheus.Desc) {
+	descs <- d.dhtNodes
+	descs <- d.peerConnections
+	descs <- d.queuedIOJobs
+	descs <- d.queuedIOBytes
+	descs <- d.averageTimeQueue
+	descs <- d.readCacheHits
+	descs <- d.readCacheOverload
+	descs <- d.writeCacheOverload
+	descs <- d.buffersSize
+	descs <- d.wastedSession
+	descs <- d.globalRatio
+	descs <- d.connectionStatus
+	descs <- d.altSpeedEnabled
+	descs <- d.downloadRateLimit
+	descs <- d.uploadRateLimit
+}
+
+// collect 未知的字段不输出
+func (d sessionDescs) collect(metrics chan<- prometheus.Metric, s client.Session) {
+	gauge := func(desc *prometheus.Desc, value float64) {
+		if value >= 0 {
+			metrics <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value)
+		}
+	}
+	gauge(d.dhtNodes, float64(s.DHTNodes))
+	gauge(d.peerConnections, float64(s.PeerConnections))
+	gauge(d.queuedIOJobs, float64(s.QueuedIOJobs))
+	gauge(d.queuedIOBytes, float64(s.QueuedIOBytes))
+	gauge(d.averageTimeQueue, s.AverageTimeQueue)
+	gauge(d.readCacheHits, s.ReadCacheHits)
+	gauge(d.readCacheOverload, s.ReadCacheOverload)
+	gauge(d.writeCacheOverload, s.WriteCacheOverload)
+	gauge(d.buffersSize, float64(s.BuffersSize))
+	gauge(d.wastedSession, float64(s.WastedSession))
+	gauge(d.globalRatio, s.GlobalRatio)
+	gauge(d.downloadRateLimit, float64(s.DownloadRateLimit))
+	gauge(d.uploadRateLimit, float64(s.UploadRateLimit))
+	altSpeed := 0.0
+	if s.AltSpeedEnabled {
+		altSpeed = 1
+	}
+	gauge(d.altSpeedEnabled, altSpeed)
+	if s.ConnectionStatus == "" {
+		return
+	}
+	known := false
+	for _, status := range connectionStatuses {
+		value := 0.0
+		if status == s.ConnectionStatus {
+			value = 1
+			known = true
+		}
+		metrics <- prometheus.MustNewConstMetric(d.connectionStatus, prometheus.GaugeValue, value, status)
+	}
+	// 无法识别的状态原样输出
+	if !known {
+		metrics <- prometheus.MustNewConstMetric(d.connectionStatus, prometheus.GaugeValue, 1, s.ConnectionStatus)
+	}
+}
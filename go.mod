@@ -3,8 +3,10 @@ module github.com/chenpt0809/pt-exporter
 go 1.16
 
 require (
+	github.com/fsnotify/fsnotify v1.5.4
 	github.com/hekmon/transmissionrpc/v2 v2.0.1
 	github.com/prometheus/client_golang v1.11.1
 	github.com/spf13/viper v1.12.0
 	go.uber.org/zap v1.21.0
+	golang.org/x/net v0.0.0-20220520000938-2e3eb7b945c2
 )
@@ -0,0 +1,250 @@
+package initialize
+
+import (
+	"errors"
+	"fmt"
+	"github.com/chenpt0809/pt-exporter/client"
+	"github.com/chenpt0809/pt-exporter/collector"
+	"github.com/chenpt0809/pt-exporter/global"
+	"github.com/chenpt0809/pt-exporter/utils"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DownloaderConfig 单个下载器的配置 任意字段变化都需要重建采集器
+type DownloaderConfig struct {
+	Key            string // 配置文件中的键名
+	Name           string // 指标中的 name 标签
+	Type           string
+	Host           string
+	UserName       string
+	Password       string
+	Secret         string
+	MaxUpSpeed     string // 原始带宽配置 如 1Gbps
+	MaxDownSpeed   string
+	RequestTimeOut int
+	Options        collector.Options
+}
+
+// DownloaderTypes 支持的下载器类型
+var DownloaderTypes = []string{"qbittorrent", "transmission", "deluge", "rtorrent", "aria2"}
+
+// DownloaderConfigs 读取除 config 外的全部下载器配置 按键名排序
+func DownloaderConfigs(v *viper.Viper) []DownloaderConfig {
+	keys := make([]string, 0)
+	for configKey := range v.AllSettings() {
+		if configKey == "config" {
+			continue
+		}
+		keys = append(keys, configKey)
+	}
+	sort.Strings(keys)
+	configs := make([]DownloaderConfig, 0, len(keys))
+	rewriteRules := RewriteRules(v)
+	for _, configKey := range keys {
+		maxUpSpeed := speedString(v, configKey, "max-up-speed")
+		maxDownSpeed := speedString(v, configKey, "max-down-speed")
+		configs = append(configs, DownloaderConfig{
+			Key:            configKey,
+			Name:           strings.ToUpper(configKey),
+			Type:           v.GetString(configKey + ".type"),
+			Host:           v.GetString(configKey + ".host"),
+			UserName:       v.GetString(configKey + ".username"),
+			Password:       v.GetString(configKey + ".password"),
+			Secret:         v.GetString(configKey + ".secret"),
+			MaxUpSpeed:     maxUpSpeed,
+			MaxDownSpeed:   maxDownSpeed,
+			RequestTimeOut: v.GetInt("config.timeout"),
+			Options: collector.Options{
+				Lang:                  v.GetString("config.lang"),
+				MaxUpSpeed:            speedBytes(configKey+".max-up-speed", maxUpSpeed),
+				MaxDownSpeed:          speedBytes(configKey+".max-down-speed", maxDownSpeed),
+				DownloaderExporter:    v.GetBool("config.downloader-exporter"),
+				RewriteTracker:        v.GetStringMapString("config.rewrite"),
+				RewriteRules:          rewriteRules,
+				UseCategoryAsTracker:  v.GetBool("config.UseCategoryAsTracker"),
+				PollInterval:          time.Duration(v.GetInt("config.interval")) * time.Second,
+				MaxAge:                time.Duration(v.GetInt("config.max-age")) * time.Second,
+				TrackerHealth:         v.GetBool("config.tracker-health"),
+				TrackerPolicy:         v.GetString("config.tracker-policy"),
+				CategoryLabel:         v.GetBool("config.category-label"),
+				TagsLabel:             v.GetBool("config.tags-label"),
+				DisableTorrentMetrics: v.GetBool("config.disable-torrent-metrics"),
+				TopTorrents:           v.GetInt("config.top-torrents"),
+				Filters:               TorrentFilters(v, configKey),
+				FreeSpacePaths:        v.GetStringSlice(configKey + ".free-space-paths"),
+			},
+		})
+	}
+	return configs
+}
+
+// RewriteRules 读取 config.rewrite-rules 所有下载器共用
+func RewriteRules(v *viper.Viper) []collector.RewriteRule {
+	var rules []collector.RewriteRule
+	if err := v.UnmarshalKey("config.rewrite-rules", &rules); err != nil {
+		global.Logger.Error("无法解析的 tracker 重写规则", zap.Error(err))
+		return nil
+	}
+	return rules
+}
+
+// TorrentFilters 读取下载器的种子过滤规则 未配置时使用 config.filter
+func TorrentFilters(v *viper.Viper, configKey string) collector.TorrentFilters {
+	key := configKey + ".filter"
+	if !v.IsSet(key) {
+		key = "config.filter"
+	}
+	var filters collector.TorrentFilters
+	if err := v.UnmarshalKey(key, &filters); err != nil {
+		global.Logger.Error("无法解析的种子过滤规则 "+key, zap.Error(err))
+		return collector.TorrentFilters{}
+	}
+	return filters
+}
+
+// speedString 读取下载器的带宽配置 未配置时使用 config.default 中的值
+func speedString(v *viper.Viper, configKey string, name string) string {
+	speed := v.GetString(configKey + "." + name)
+	if speed == "" {
+		speed = v.GetString("config.default." + name)
+	}
+	return speed
+}
+
+// speedBytes 带宽配置转换为字节每秒 无法解析时为 0
+func speedBytes(key string, speed string) int {
+	if speed == "" {
+		return 0
+	}
+	size, err := utils.SpeedToInt(speed)
+	if err != nil {
+		global.Logger.Error("无法解析的带宽配置 "+key+": "+speed, zap.Error(err))
+		return 0
+	}
+	return int(size)
+}
+
+// Validate 校验下载器类型、地址、带宽配置及规则 用于 check 子命令
+func (c DownloaderConfig) Validate() error {
+	if err := c.ValidateClient(); err != nil {
+		return err
+	}
+	return c.ValidateRules()
+}
+
+// ValidateClient 校验下载器类型、地址及带宽配置 带宽无效时使用默认值
+func (c DownloaderConfig) ValidateClient() error {
+	known := false
+	for _, t := range DownloaderTypes {
+		if c.Type == t {
+			known = true
+			break
+		}
+	}
+	if !known {
+		return errors.New("暂时不支持下载器类型 " + c.Type)
+	}
+	if c.Host == "" {
+		return errors.New("未配置 host")
+	}
+	host, _, err := utils.GetHostAndPort(c.Host)
+	if err != nil {
+		return fmt.Errorf("无法解析的URL %s: %w", c.Host, err)
+	}
+	// rTorrent 的 unix socket 地址没有主机名
+	if u, _ := url.Parse(c.Host); host == "" && !(c.Type == "rtorrent" && (u.Scheme == "unix" || u.Scheme == "scgi+unix")) {
+		return errors.New("无法解析的URL:" + c.Host)
+	}
+	for name, speed := range map[string]string{"max-up-speed": c.MaxUpSpeed, "max-down-speed": c.MaxDownSpeed} {
+		if speed == "" {
+			continue
+		}
+		if _, err := utils.SpeedToInt(speed); err != nil {
+			return fmt.Errorf("无法解析的带宽配置 %s: %s", name, speed)
+		}
+	}
+	return nil
+}
+
+// ValidateRules 校验 tracker 标签策略、重写规则及种子过滤规则
+// 跳过无效的规则会输出与配置不一致的指标 校验失败时不应添加该下载器
+func (c DownloaderConfig) ValidateRules() error {
+	switch c.Options.TrackerPolicy {
+	case collector.TrackerPolicyPrimary, collector.TrackerPolicyWorking, collector.TrackerPolicyAll:
+	default:
+		return errors.New("不支持的 tracker-policy " + c.Options.TrackerPolicy + " 仅支持 primary、working、all")
+	}
+	for _, r := range c.Options.RewriteRules {
+		if err := r.Validate(); err != nil {
+			return fmt.Errorf("无效的 tracker 重写规则 %s: %w", r.Pattern, err)
+		}
+	}
+	if err := c.Options.Filters.Validate(); err != nil {
+		return fmt.Errorf("无效的种子过滤规则: %w", err)
+	}
+	return nil
+}
+
+// NewDownloader 根据下载器类型创建客户端
+func NewDownloader(c DownloaderConfig) (client.Downloader, error) {
+	switch c.Type {
+	case "qbittorrent":
+		return client.NewQbittorrentClient(
+			client.QbittorrentOptions{
+				Url:            c.Host,
+				UserName:       c.UserName,
+				Password:       c.Password,
+				RequestTimeOut: c.RequestTimeOut,
+			},
+		), nil
+	case "transmission":
+		trc := client.NewTransmissionClient(
+			client.TransmissionOptions{
+				Url:            c.Host,
+				UserName:       c.UserName,
+				Password:       c.Password,
+				RequestTimeOut: c.RequestTimeOut,
+			},
+		)
+		if trc == nil {
+			return nil, errors.New("无法解析的URL:" + c.Host)
+		}
+		return trc, nil
+	case "deluge":
+		return client.NewDelugeClient(
+			client.DelugeOptions{
+				Url:            c.Host,
+				Password:       c.Password,
+				RequestTimeOut: c.RequestTimeOut,
+			},
+		), nil
+	case "rtorrent":
+		rtc := client.NewRtorrentClient(
+			client.RtorrentOptions{
+				Url:            c.Host,
+				UserName:       c.UserName,
+				Password:       c.Password,
+				RequestTimeOut: c.RequestTimeOut,
+			},
+		)
+		if rtc == nil {
+			return nil, errors.New("无法解析的URL:" + c.Host)
+		}
+		return rtc, nil
+	case "aria2":
+		return client.NewAria2Client(
+			client.Aria2Options{
+				Url:            c.Host,
+				Secret:         c.Secret,
+				RequestTimeOut: c.RequestTimeOut,
+			},
+		), nil
+	default:
+		return nil, errors.New("暂时不支持下载器类型 " + c.Type)
+	}
+}
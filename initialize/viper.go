@@ -0,0 +1,61 @@
+package initialize
+
+import (
+	"fmt"
+	"github.com/spf13/viper"
+	"path/filepath"
+	"strings"
+)
+
+// EnvPrefix 环境变量前缀 如 PT_EXPORTER_CONFIG_LISTEN 覆盖 config.listen
+const EnvPrefix = "PT_EXPORTER"
+
+// Viper 读取配置文件 path 为空时在当前目录查找 config.yml
+// 配置项均可使用环境变量覆盖 键名中的 . 和 - 替换为 _ 例如 PT_EXPORTER_HOST_QB_PASSWORD
+func Viper(path string) (*viper.Viper, error) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	resolved := "./config.yml"
+	if path != "" {
+		v.SetConfigFile(path)
+		resolved = path
+	} else {
+		v.SetConfigName("config")
+		v.AddConfigPath(".")
+	}
+	if abs, err := filepath.Abs(resolved); err == nil {
+		resolved = abs
+	}
+	// 环境变量覆盖
+	v.SetEnvPrefix(EnvPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_", "-", "_"))
+	v.AutomaticEnv()
+	// 配置默认日志等级
+	v.SetDefault("config.logLevel", "info")
+	// 配置默认监听端口
+	v.SetDefault("config.listen", ":9200")
+	// 配置默认 Downloader-exporter 兼容模式
+	v.SetDefault("config.downloader-exporter", false)
+	// 配置默认语言
+	v.SetDefault("config.lang", "zh")
+	// 配置默认请求超时时间
+	v.SetDefault("config.timeout", 10)
+	// 配置默认轮询间隔 单位秒
+	v.SetDefault("config.interval", 15)
+	// 默认不获取 tracker 汇报状态 qBittorrent 需要为每个种子单独请求
+	v.SetDefault("config.tracker-health", false)
+	// 默认使用下载器报告的主 tracker 作为标签
+	v.SetDefault("config.tracker-policy", "primary")
+	// 默认种子指标不添加分类及标签
+	v.SetDefault("config.category-label", false)
+	v.SetDefault("config.tags-label", false)
+	// 默认输出全部种子的种子维度指标
+	v.SetDefault("config.disable-torrent-metrics", false)
+	v.SetDefault("config.top-torrents", 0)
+	// 累计流量默认只保存在内存中
+	v.SetDefault("config.state-file", "")
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("读取配置文件失败 %s: %w", resolved, err)
+	}
+	return v, nil
+}
@@ -1,119 +1,127 @@
 package main
 
 import (
+	"encoding/json"
+	"flag"
 	"fmt"
-	"github.com/chenpt0809/pt-exporter/client"
 	"github.com/chenpt0809/pt-exporter/collector"
 	"github.com/chenpt0809/pt-exporter/global"
 	"github.com/chenpt0809/pt-exporter/initialize"
+	"github.com/fsnotify/fsnotify"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
-	viper2 "github.com/spf13/viper"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"sync"
+	"syscall"
 )
 
 func main() {
+	// 子命令 pt-exporter check 校验配置并测试连接
+	if len(os.Args) > 1 && os.Args[1] == "check" {
+		os.Exit(runCheck(os.Args[2:]))
+	}
+	configPath := flag.String("config", "", "配置文件路径 默认读取当前目录下的 config.yml")
+	listenAddr := flag.String("listen", "", "监听地址 覆盖配置文件中的 config.listen")
+	enableLifecycle := flag.Bool("web.enable-lifecycle", false, "启用 POST /-/reload 重新加载配置")
+	flag.Parse()
 	// 读取配置文件
-	viper := viper2.New()
-	viper.SetConfigName("config")
-	viper.SetConfigType("yaml")
-	viper.AddConfigPath(".")
-	// 配置默认日志等级
-	viper.SetDefault("config.logLevel", "info")
-	// 配置默认监听端口
-	viper.SetDefault("config.listen", ":9200")
-	// 配置默认 Downloader-exporter 兼容模式
-	viper.SetDefault("config.downloader-exporter", false)
-	// 配置默认语言
-	viper.SetDefault("config.lang", "zh")
-	if err := viper.ReadInConfig(); err != nil {
-		fmt.Println("读取配置文件失败", zap.Error(err))
-		return
+	viper, err := initialize.Viper(*configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
-	// 配置默认请求超时时间
-	viper.SetDefault("config.timeout", 10)
-	// 配置日志相关
-	var LogLevel zap.AtomicLevel
-	switch viper.GetString("config.logLevel") {
-	case "debug":
-		LogLevel = zap.NewAtomicLevelAt(zap.DebugLevel)
-	default:
-		LogLevel = zap.NewAtomicLevelAt(zap.InfoLevel)
+	if *listenAddr != "" {
+		viper.Set("config.listen", *listenAddr)
 	}
+	// 配置日志相关
+	LogLevel := zap.NewAtomicLevelAt(logLevel(viper.GetString("config.logLevel")))
 	global.Logger = initialize.Zap(LogLevel)
 	// 配置下载器
-	for configKey, _ := range viper.AllSettings() {
-		hostName := strings.ToUpper(configKey)
-		if configKey == "config" {
-			continue
+	// 累计流量 修改 state-file 需要重启
+	stateFile := viper.GetString("config.state-file")
+	counters, err := collector.NewCounterStore(stateFile)
+	if counters == nil {
+		// 继续运行会在保存时覆盖原有记录
+		global.Logger.Error("读取累计流量失败\t"+stateFile, zap.Error(err))
+		os.Exit(1)
+	} else if err != nil {
+		global.Logger.Error("累计流量文件损坏 重新开始累计\t"+stateFile, zap.Error(err))
+	}
+	go counters.Run(collector.CounterSaveInterval)
+	// 退出前保存累计流量
+	shutdown := make(chan os.Signal, 1)
+	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-shutdown
+		if err := counters.Save(); err != nil {
+			global.Logger.Error("保存累计流量失败\t"+stateFile, zap.Error(err))
 		}
-		clientType := viper.GetStringMapString(configKey)["type"]
-		// 根据下载器配置
-		switch clientType {
-		// 创建qb对象
-		case "qbittorrent":
-			global.Logger.Debug("初始化 qbittorrent 客户端\t" + hostName)
-			qbc := client.NewQbittorrentClient(
-				client.QbittorrentOptions{
-					Url:            viper.GetStringMapString(configKey)["host"],
-					UserName:       viper.GetStringMapString(configKey)["username"],
-					Password:       viper.GetStringMapString(configKey)["password"],
-					RequestTimeOut: viper.GetInt("config.timeout"),
-				},
-			)
-			collOpt := collector.Options{
-				Lang:                 viper.GetString("config.lang"),
-				MaxUpSpeed:           viper.GetInt("config.maxupspeed"),
-				MaxDownSpeed:         viper.GetInt("config.maxdownspeed"),
-				DownloaderExporter:   viper.GetBool("config.downloader-exporter"),
-				RewriteTracker:       viper.GetStringMapString("config.rewrite"),
-				UseCategoryAsTracker: viper.GetBool("config.UseCategoryAsTracker"),
-			}
-			coll := collector.NewQbittorrentCollector(
-				hostName,
-				qbc,
-				collOpt,
-			)
-			prometheus.MustRegister(coll)
-			global.Logger.Info("添加监控完成\t" + hostName)
-		case "transmission":
-			global.Logger.Debug("初始化 transmission 客户端\t" + hostName)
-			trc := client.NewTransmissionClient(
-				client.TransmissionOptions{
-					Url:            viper.GetStringMapString(configKey)["host"],
-					UserName:       viper.GetStringMapString(configKey)["username"],
-					Password:       viper.GetStringMapString(configKey)["password"],
-					RequestTimeOut: viper.GetInt("config.timeout"),
-				},
-			)
-			collOpt := collector.Options{
-				Lang:                 viper.GetString("config.lang"),
-				MaxUpSpeed:           viper.GetInt("config.maxupspeed"),
-				MaxDownSpeed:         viper.GetInt("config.maxdownspeed"),
-				DownloaderExporter:   viper.GetBool("config.downloader-exporter"),
-				RewriteTracker:       viper.GetStringMapString("config.rewrite"),
-				UseCategoryAsTracker: viper.GetBool("config.UseCategoryAsTracker"),
-			}
-
-			coll := collector.NewTransmissionCollector(
-				hostName,
-				trc,
-				collOpt,
-			)
-			prometheus.MustRegister(coll)
-			global.Logger.Info("添加监控完成\t" + hostName)
-		default:
-			global.Logger.Error("暂时不支持下载器类型")
+		os.Exit(0)
+	}()
+	manager := NewManager(prometheus.DefaultRegisterer, counters)
+	manager.Reconcile(initialize.DownloaderConfigs(viper))
+	// 启动后热加载会重新读取配置 之后不能在锁外读取 viper
+	listen := viper.GetString("config.listen")
+	// 热加载 重新读取配置文件后调整日志等级并重建采集器 viper 不支持并发 全部读取在锁内进行
+	var reloadMutex sync.Mutex
+	reload := func() error {
+		reloadMutex.Lock()
+		defer reloadMutex.Unlock()
+		if err := viper.ReadInConfig(); err != nil {
+			global.Logger.Error("重新加载配置文件失败", zap.Error(err))
+			return err
 		}
+		LogLevel.SetLevel(logLevel(viper.GetString("config.logLevel")))
+		manager.Reconcile(initialize.DownloaderConfigs(viper))
+		global.Logger.Info("重新加载配置文件完成\t" + viper.ConfigFileUsed())
+		return nil
 	}
+	// 配置文件变化时重新加载 不使用 viper.WatchConfig 其在锁外读取配置
+	if err := watchConfig(viper.ConfigFileUsed(), reload); err != nil {
+		global.Logger.Error("监听配置文件失败", zap.Error(err))
+	}
+	// SIGHUP 重新加载
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	go func() {
+		for range sighup {
+			global.Logger.Info("收到 SIGHUP 重新加载配置文件")
+			_ = reload()
+		}
+	}()
 
 	// 配置路由
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) { http.Redirect(w, r, "/metrics", 302) })
 	http.Handle("/metrics", promhttp.Handler())
+	// 与 Prometheus 一致 需要 --web.enable-lifecycle 开启
+	http.HandleFunc("/-/reload", func(w http.ResponseWriter, r *http.Request) {
+		if !*enableLifecycle {
+			http.Error(w, "未启用 --web.enable-lifecycle", http.StatusForbidden)
+			return
+		}
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "仅支持 POST 请求", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := reload(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte("ok\n"))
+	})
+	// 调试 列出没有匹配重写规则的 tracker 域名
+	http.HandleFunc("/-/trackers/unmatched", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(manager.UnmatchedTrackers())
+	})
 	// 配置监听
-	listen := viper.GetString("config.listen")
 	if !strings.Contains(listen, ":") {
 		listen = ":" + listen
 	}
@@ -123,3 +131,53 @@ func main() {
 		return
 	}
 }
+
+// watchConfig 监听配置文件所在目录 配置文件被修改、替换或符号链接指向变化时调用 reload
+func watchConfig(configFile string, reload func() error) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	configFile = filepath.Clean(configFile)
+	realConfigFile, _ := filepath.EvalSymlinks(configFile)
+	if err := watcher.Add(filepath.Dir(configFile)); err != nil {
+		_ = watcher.Close()
+		return err
+	}
+	go func() {
+		defer watcher.Close()
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				// Kubernetes ConfigMap 等通过替换符号链接更新
+				currentConfigFile, _ := filepath.EvalSymlinks(configFile)
+				written := filepath.Clean(event.Name) == configFile && event.Op&(fsnotify.Write|fsnotify.Create) != 0
+				if !written && (currentConfigFile == "" || currentConfigFile == realConfigFile) {
+					continue
+				}
+				realConfigFile = currentConfigFile
+				global.Logger.Info("配置文件发生变化\t" + event.Name)
+				_ = reload()
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				global.Logger.Error("监听配置文件出错", zap.Error(err))
+			}
+		}
+	}()
+	return nil
+}
+
+// logLevel 配置中的日志等级
+func logLevel(level string) zapcore.Level {
+	switch level {
+	case "debug":
+		return zap.DebugLevel
+	default:
+		return zap.InfoLevel
+	}
+}
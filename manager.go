@@ -0,0 +1,149 @@
+package main
+
+import (
+	"github.com/chenpt0809/pt-exporter/client"
+	"github.com/chenpt0809/pt-exporter/collector"
+	"github.com/chenpt0809/pt-exporter/global"
+	"github.com/chenpt0809/pt-exporter/initialize"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"reflect"
+	"sync"
+)
+
+// managedCollector 已注册的采集器及创建它的配置
+type managedCollector struct {
+	config     initialize.DownloaderConfig
+	downloader client.Downloader
+	collector  *collector.Collector
+	version    string // 兼容模式 version 标签使用的版本
+}
+
+// Manager 根据配置维护已注册的采集器 支持配置热加载
+type Manager struct {
+	registerer prometheus.Registerer
+	counters   *collector.CounterStore
+	collectors map[string]*managedCollector
+	versions   map[string]string // 兼容模式下每个下载器最近一次获取到的版本
+	mutex      sync.Mutex
+}
+
+func NewManager(registerer prometheus.Registerer, counters *collector.CounterStore) *Manager {
+	return &Manager{
+		registerer: registerer,
+		counters:   counters,
+		collectors: make(map[string]*managedCollector),
+		versions:   make(map[string]string),
+	}
+}
+
+// Reconcile 对比新配置 注销已删除的下载器 注册新增的下载器 重建配置发生变化的下载器
+func (m *Manager) Reconcile(configs []initialize.DownloaderConfig) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	desired := make(map[string]initialize.DownloaderConfig, len(configs))
+	for _, c := range configs {
+		desired[c.Key] = c
+	}
+	// 先注销 避免新旧采集器标签冲突
+	for key, mc := range m.collectors {
+		c, ok := desired[key]
+		if ok && reflect.DeepEqual(c, mc.config) {
+			continue
+		}
+		mc.collector.Stop()
+		m.registerer.Unregister(mc.collector)
+		delete(m.collectors, key)
+		if ok {
+			global.Logger.Info("配置变化 重建监控\t" + mc.config.Name)
+		} else {
+			delete(m.versions, key)
+			global.Logger.Info("移除监控\t" + mc.config.Name)
+		}
+	}
+	for _, c := range configs {
+		if _, ok := m.collectors[c.Key]; ok {
+			continue
+		}
+		global.Logger.Debug("初始化 " + c.Type + " 客户端\t" + c.Name)
+		// 地址、带宽校验失败时使用默认值 不阻止启动 可使用 check 子命令检查
+		if err := c.ValidateClient(); err != nil {
+			global.Logger.Warn("配置校验失败\t"+c.Name, zap.Error(err))
+		}
+		// tracker 标签策略、重写规则、过滤规则无效时不添加该下载器 避免输出与配置不一致的指标
+		if err := c.ValidateRules(); err != nil {
+			global.Logger.Error("规则配置无效 跳过该下载器\t"+c.Name, zap.Error(err))
+			continue
+		}
+		downloader, err := initialize.NewDownloader(c)
+		if err != nil {
+			global.Logger.Error("创建下载器失败\t"+c.Name, zap.Error(err))
+			continue
+		}
+		if err := m.start(c, downloader, m.versions[c.Key]); err != nil {
+			global.Logger.Error("注册监控失败\t"+c.Name, zap.Error(err))
+			continue
+		}
+		global.Logger.Info("添加监控完成\t" + c.Name)
+	}
+}
+
+// start 创建、注册并启动采集器 调用方需要持有锁
+func (m *Manager) start(c initialize.DownloaderConfig, downloader client.Downloader, version string) error {
+	options := c.Options
+	options.ClientVersion = version
+	coll := collector.NewCollector(
+		c.Name,
+		c.Host,
+		c.Type,
+		downloader,
+		options,
+	)
+	coll.SetCounterStore(m.counters)
+	// 兼容模式的 version 为固定标签 在轮询中获取到版本后替换
+	if options.DownloaderExporter {
+		coll.SetVersionHandler(func(v string) {
+			go m.updateVersion(c.Key, coll, v)
+		})
+	}
+	if err := m.registerer.Register(coll); err != nil {
+		return err
+	}
+	coll.Start()
+	m.collectors[c.Key] = &managedCollector{config: c, downloader: downloader, collector: coll, version: version}
+	return nil
+}
+
+// updateVersion 兼容模式下版本变化时替换采集器的 version 标签 轮询及自身指标保持不变
+func (m *Manager) updateVersion(key string, coll *collector.Collector, version string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	mc, ok := m.collectors[key]
+	// 采集器已被重建或移除
+	if !ok || mc.collector != coll || version == "" || version == mc.version {
+		return
+	}
+	m.versions[key] = version
+	// 描述符变化 先按旧的描述符注销
+	m.registerer.Unregister(mc.collector)
+	mc.collector.SetClientVersion(version)
+	if err := m.registerer.Register(mc.collector); err != nil {
+		global.Logger.Error("注册监控失败\t"+mc.config.Name, zap.Error(err))
+		mc.collector.Stop()
+		delete(m.collectors, key)
+		return
+	}
+	mc.version = version
+	global.Logger.Info("版本变化 更新监控标签\t" + mc.config.Name + " " + version)
+}
+
+// UnmatchedTrackers 每个下载器最近一次轮询中没有匹配重写规则的 tracker 域名
+func (m *Manager) UnmatchedTrackers() map[string][]string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	result := make(map[string][]string, len(m.collectors))
+	for _, mc := range m.collectors {
+		result[mc.config.Name] = mc.collector.UnmatchedTrackers()
+	}
+	return result
+}
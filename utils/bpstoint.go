@@ -2,28 +2,30 @@ package utils
 
 import (
 	"errors"
-	"github.com/chenpt0809/pt-exporter/global"
 	"regexp"
 	"strconv"
 	"strings"
 )
 
+// speedUnits 带宽单位 比特每秒 按 1000 进制换算
+var speedUnits = map[string]float64{
+	"K": 1000,
+	"M": 1000 * 1000,
+	"G": 1000 * 1000 * 1000,
+}
+
+var speedRegexp = regexp.MustCompile(`^(\d+(?:\.\d+)?)\s*([KMG])BPS$`)
+
+// SpeedToInt 将带宽字符串转换为每秒字节数 如 1Gbps、100Mbps、512Kbps
+// 带宽单位为比特 按 1000 进制换算后除以 8
 func SpeedToInt(s string) (size float64, err error) {
-	global.Logger.Debug("速度转换 " + s)
-	s = strings.ToUpper(s)
-	re := regexp.MustCompile(`\d+`)
-	nums := re.Find([]byte(s))
-	num, err := strconv.Atoi(string(nums))
-	if err != nil {
-		global.Logger.Error("未匹配到数字")
-		return float64(0), errors.New("未匹配到数据")
+	m := speedRegexp.FindStringSubmatch(strings.ToUpper(strings.TrimSpace(s)))
+	if m == nil {
+		return float64(0), errors.New("无法解析的带宽 " + s + " 仅支持 Gbps、Mbps、Kbps")
 	}
-	if strings.HasSuffix(s, "GBPS") {
-		return float64(num * 1024 * 1024 * 1024), nil
-	} else if strings.HasSuffix(s, "MBPS") {
-		return float64(num * 1024 * 1024), nil
-	} else {
-		global.Logger.Error("不支持的进制 仅支持 Gbps、Mbps")
-		return float64(0), errors.New("不支持的进制 仅支持 Gbps、Mbps")
+	num, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return float64(0), err
 	}
+	return num * speedUnits[m[2]] / 8, nil
 }
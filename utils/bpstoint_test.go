@@ -0,0 +1,35 @@
+package utils
+
+import "testing"
+
+func TestSpeedToInt(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    float64
+		wantErr bool
+	}{
+		{in: "1Gbps", want: 125000000},
+		{in: "100Mbps", want: 12500000},
+		{in: "512kbps", want: 64000},
+		{in: " 2.5 Gbps ", want: 312500000},
+		{in: "1xGbps", wantErr: true},
+		{in: "10 garbage Mbps", wantErr: true},
+		{in: "Gbps", wantErr: true},
+		{in: "100", wantErr: true},
+		{in: "100MB", wantErr: true},
+		{in: "1Tbps", wantErr: true},
+		{in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := SpeedToInt(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("SpeedToInt(%q) = %v, want error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("SpeedToInt(%q) = %v, %v, want %v", tt.in, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package utils
+
+import "errors"
+
+// DiskFree 当前系统不支持
+func DiskFree(path string) (int64, error) {
+	return 0, errors.New("当前系统不支持获取磁盘空间 " + path)
+}
@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// sizeUnits 大小单位 按 1024 进制换算 与 PT 站点显示一致
+var sizeUnits = map[string]float64{
+	"":    1,
+	"B":   1,
+	"K":   1 << 10,
+	"KB":  1 << 10,
+	"KIB": 1 << 10,
+	"M":   1 << 20,
+	"MB":  1 << 20,
+	"MIB": 1 << 20,
+	"G":   1 << 30,
+	"GB":  1 << 30,
+	"GIB": 1 << 30,
+	"T":   1 << 40,
+	"TB":  1 << 40,
+	"TIB": 1 << 40,
+}
+
+var sizeRegexp = regexp.MustCompile(`^(\d+(?:\.\d+)?)\s*([A-Z]*)$`)
+
+// SizeToInt 将大小字符串转换为字节数 如 500MB、1.5GiB、1024 不带单位时为字节
+func SizeToInt(s string) (int64, error) {
+	m := sizeRegexp.FindStringSubmatch(strings.ToUpper(strings.TrimSpace(s)))
+	if m == nil {
+		return 0, errors.New("无法解析的大小 " + s)
+	}
+	unit, ok := sizeUnits[m[2]]
+	if !ok {
+		return 0, errors.New("不支持的单位 " + m[2] + " 仅支持 B、KB、MB、GB、TB")
+	}
+	num, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, err
+	}
+	return int64(num * unit), nil
+}